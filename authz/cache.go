@@ -0,0 +1,170 @@
+package authz
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rbacTables are the tables whose writes can change what a user is granted.
+var rbacTables = map[string]bool{
+	"users":             true,
+	"roles":             true,
+	"groups":            true,
+	"permissions":       true,
+	"user_roles":        true,
+	"user_groups":       true,
+	"role_permissions":  true,
+	"group_permissions": true,
+	"role_parents":      true,
+}
+
+type cachedResolution struct {
+	resolution *Resolution
+	expiresAt  time.Time
+}
+
+var (
+	cacheTTL     time.Duration
+	resolutions  = map[string]cachedResolution{}
+	resolutionMu sync.RWMutex
+)
+
+// SetupCache caches resolved permissions for ttl. Writes to any RBAC table through initializers.DB clear the
+// cache right away, and only for the users written when a write to users names them. Writes made by other
+// replicas are picked up once entries expire.
+func SetupCache(ttl time.Duration) error {
+
+	cacheTTL = ttl
+	if ttl <= 0 {
+		return nil
+	}
+	invalidate := func(db *gorm.DB) {
+		if db.Error != nil || db.Statement == nil || !rbacTables[db.Statement.Table] {
+			return
+		}
+		if db.Statement.Table == "users" {
+			if usernames, ok := writtenUsers(db.Statement); ok {
+				InvalidateUsers(usernames...)
+				return
+			}
+		}
+		InvalidateCache()
+	}
+	callbacks := initializers.DB.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("authz:invalidate_create", invalidate); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("authz:invalidate_update", invalidate); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("authz:invalidate_delete", invalidate); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().After("gorm:raw").Register("authz:invalidate_raw", func(db *gorm.DB) { InvalidateCache() }); err != nil {
+		return err
+	}
+	fmt.Println("✅ Authorization Cache Setup")
+	return nil
+}
+
+func InvalidateCache() {
+	resolutionMu.Lock()
+	resolutions = map[string]cachedResolution{}
+	resolutionMu.Unlock()
+}
+
+// InvalidateUsers drops the cached permissions of the given users only.
+func InvalidateUsers(usernames ...string) {
+	resolutionMu.Lock()
+	for _, username := range usernames {
+		delete(resolutions, username)
+	}
+	resolutionMu.Unlock()
+}
+
+// writtenUsers tells the users a write to the users table touched, from the users it was made on or a
+// "username = ?" condition. It reports false when it can't tell.
+func writtenUsers(statement *gorm.Statement) ([]string, bool) {
+
+	usernames := []string{}
+	if statement.ReflectValue.IsValid() && statement.ReflectValue.CanInterface() {
+		switch value := statement.ReflectValue.Interface().(type) {
+		case models.User:
+			if len(value.Username) > 0 {
+				usernames = append(usernames, value.Username)
+			}
+		case []models.User:
+			for _, user := range value {
+				if len(user.Username) == 0 {
+					return nil, false
+				}
+				usernames = append(usernames, user.Username)
+			}
+		}
+	}
+	if len(usernames) > 0 {
+		return usernames, true
+	}
+	where, ok := statement.Clauses["WHERE"].Expression.(clause.Where)
+	if !ok {
+		return nil, false
+	}
+	for _, expression := range where.Exprs {
+		expr, ok := expression.(clause.Expr)
+		if !ok || expr.SQL != "username = ?" || len(expr.Vars) != 1 {
+			continue
+		}
+		if username, ok := expr.Vars[0].(string); ok {
+			return []string{username}, true
+		}
+	}
+	return nil, false
+}
+
+// cachedResolve returns a copy of the cached resolution, so callers are free to change it.
+func cachedResolve(username string) (*Resolution, error) {
+
+	if cacheTTL <= 0 {
+		return resolve(username, nil)
+	}
+	resolutionMu.RLock()
+	cached, ok := resolutions[username]
+	resolutionMu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.resolution.clone(), nil
+	}
+
+	resolution, err := resolve(username, nil)
+	if err != nil {
+		return nil, err
+	}
+	resolutionMu.Lock()
+	resolutions[username] = cachedResolution{resolution: resolution, expiresAt: time.Now().Add(cacheTTL)}
+	resolutionMu.Unlock()
+	return resolution.clone(), nil
+}
+
+// clone copies resolution down to the sources of its grants.
+func (resolution *Resolution) clone() *Resolution {
+
+	copied := *resolution
+	copied.Roles = append(make([]models.Role, 0, len(resolution.Roles)), resolution.Roles...)
+	copied.Groups = append(make([]models.Group, 0, len(resolution.Groups)), resolution.Groups...)
+	copied.Grants = make([]Grant, len(resolution.Grants))
+	for i, grant := range resolution.Grants {
+		grant.Sources = append(make([]Source, 0, len(grant.Sources)), grant.Sources...)
+		for j, source := range grant.Sources {
+			if source.Via != nil {
+				grant.Sources[j].Via = append([]string{}, source.Via...)
+			}
+		}
+		copied.Grants[i] = grant
+	}
+	return &copied
+}
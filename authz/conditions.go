@@ -0,0 +1,66 @@
+package authz
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Attributes are the fields of a subject or resource a condition can refer to, e.g. subject.username or resource.creator.
+type Attributes map[string]interface{}
+
+var (
+	programs   = map[string]*vm.Program{}
+	programsMu sync.RWMutex
+)
+
+func conditionEnv(subject Attributes, resource Attributes) map[string]interface{} {
+	return map[string]interface{}{
+		"subject":  map[string]interface{}(subject),
+		"resource": map[string]interface{}(resource),
+	}
+}
+
+// CompileCondition checks that condition is a valid boolean expression and caches the compiled program.
+func CompileCondition(condition string) (*vm.Program, error) {
+
+	programsMu.RLock()
+	program, ok := programs[condition]
+	programsMu.RUnlock()
+	if ok {
+		return program, nil
+	}
+
+	program, err := expr.Compile(condition, expr.Env(conditionEnv(Attributes{}, Attributes{})), expr.AsBool())
+	if err != nil {
+		return nil, err
+	}
+	programsMu.Lock()
+	programs[condition] = program
+	programsMu.Unlock()
+	return program, nil
+}
+
+// EvaluateCondition reports whether the condition holds for the subject acting on the resource.
+// An empty condition always holds.
+func EvaluateCondition(condition string, subject Attributes, resource Attributes) (bool, error) {
+
+	if len(condition) == 0 {
+		return true, nil
+	}
+	program, err := CompileCondition(condition)
+	if err != nil {
+		return false, err
+	}
+	output, err := expr.Run(program, conditionEnv(subject, resource))
+	if err != nil {
+		return false, err
+	}
+	result, ok := output.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition %q didn't evaluate to a boolean", condition)
+	}
+	return result, nil
+}
@@ -0,0 +1,350 @@
+package authz
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+)
+
+const (
+	SourceRole  = "role"
+	SourceGroup = "group"
+
+	// EffectConditional marks a grant that is only allowed through conditional sources.
+	EffectConditional = "conditional"
+)
+
+// Source is the role or group a permission was granted or denied through. For inherited
+// permissions, Via lists the roles walked through to reach the granting role.
+type Source struct {
+	Type      string   `json:"type"`
+	Name      string   `json:"name"`
+	Via       []string `json:"via,omitempty"`
+	Effect    string   `json:"effect"`
+	Condition string   `json:"condition,omitempty"`
+}
+
+func (source Source) String() string {
+	if len(source.Via) > 0 {
+		return fmt.Sprintf("%s %s (via %s)", source.Type, source.Name, strings.Join(source.Via, " -> "))
+	}
+	return fmt.Sprintf("%s %s", source.Type, source.Name)
+}
+
+// Grant is an effective permission together with every source granting or denying it.
+// Effect is deny as soon as a single unconditional source denies the permission.
+type Grant struct {
+	Permission models.Permission `json:"permission"`
+	Effect     string            `json:"effect"`
+	Sources    []Source          `json:"sources"`
+}
+
+// GrantedPermission is a permission attached to a single role or group.
+type GrantedPermission struct {
+	Permission models.Permission `json:"permission"`
+	Effect     string            `json:"effect"`
+	Condition  string            `json:"condition,omitempty"`
+}
+
+// Resolution is everything a user is granted at a point in time.
+type Resolution struct {
+	User   models.User
+	Roles  []models.Role
+	Groups []models.Group
+	Grants []Grant
+}
+
+// Decision is the outcome of an authorization check.
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+func PermissionName(table string, operation string) string {
+	return fmt.Sprintf("%s_%s", strings.ToLower(operation), table)
+}
+
+// ActiveMembership restricts a query to join rows of table whose validity window contains now.
+func ActiveMembership(table string, now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(fmt.Sprintf("(%[1]s.valid_from IS NULL OR %[1]s.valid_from <= ?) AND (%[1]s.valid_until IS NULL OR %[1]s.valid_until > ?)", table), now, now)
+	}
+}
+
+func RolePermissions(roleID uint) ([]GrantedPermission, error) {
+
+	var links []models.RolePermission
+	if result := initializers.DB.Find(&links, "role_id = ?", roleID); result.Error != nil {
+		return nil, result.Error
+	}
+	granted := map[uint]GrantedPermission{}
+	for _, link := range links {
+		granted[link.PermissionID] = GrantedPermission{Effect: link.Effect, Condition: link.Condition}
+	}
+	return withPermissions(granted)
+}
+
+func GroupPermissions(groupID uint) ([]GrantedPermission, error) {
+
+	var links []models.GroupPermission
+	if result := initializers.DB.Find(&links, "group_id = ?", groupID); result.Error != nil {
+		return nil, result.Error
+	}
+	granted := map[uint]GrantedPermission{}
+	for _, link := range links {
+		granted[link.PermissionID] = GrantedPermission{Effect: link.Effect, Condition: link.Condition}
+	}
+	return withPermissions(granted)
+}
+
+func withPermissions(granted map[uint]GrantedPermission) ([]GrantedPermission, error) {
+
+	entries := []GrantedPermission{}
+	if len(granted) == 0 {
+		return entries, nil
+	}
+	ids := []uint{}
+	for id := range granted {
+		ids = append(ids, id)
+	}
+	var permissions []models.Permission
+	if result := initializers.DB.Order("name").Find(&permissions, ids); result.Error != nil {
+		return nil, result.Error
+	}
+	for _, permission := range permissions {
+		entry := granted[permission.ID]
+		entry.Permission = permission
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Resolve loads the user with its active roles and groups and resolves every permission granted or denied
+// through them and the roles they inherit from. Memberships outside their validity window are ignored.
+func Resolve(username string) (*Resolution, error) {
+	return cachedResolve(username)
+}
+
+func resolve(username string, scenario *Scenario) (*Resolution, error) {
+
+	var user models.User
+	if result := initializers.DB.Take(&user, "username = ?", username); result.Error != nil {
+		return nil, result.Error
+	}
+	now := time.Now()
+	var roles []models.Role
+	if result := initializers.DB.Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", user.ID).Scopes(ActiveMembership("user_roles", now)).Find(&roles); result.Error != nil {
+		return nil, result.Error
+	}
+	var groups []models.Group
+	if result := initializers.DB.Joins("JOIN user_groups ON user_groups.group_id = groups.id").
+		Where("user_groups.user_id = ?", user.ID).Scopes(ActiveMembership("user_groups", now)).Find(&groups); result.Error != nil {
+		return nil, result.Error
+	}
+	roles, groups = scenario.memberships(user.Username, roles, groups)
+
+	grants := []Grant{}
+	index := map[string]int{}
+	add := func(source Source, granted []GrantedPermission) {
+		for _, entry := range granted {
+			source.Effect = entry.Effect
+			source.Condition = entry.Condition
+			i, ok := index[entry.Permission.Name]
+			if !ok {
+				i = len(grants)
+				index[entry.Permission.Name] = i
+				grants = append(grants, Grant{Permission: entry.Permission, Sources: []Source{}})
+			}
+			grants[i].Sources = append(grants[i].Sources, source)
+		}
+	}
+
+	for _, role := range roles {
+		chain, err := roleChain(role.Name, scenario)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range chain {
+			add(Source{Type: SourceRole, Name: link.Role.Name, Via: link.Via}, link.Permissions)
+		}
+	}
+	for _, group := range groups {
+		granted, err := scenario.groupPermissions(group.ID)
+		if err != nil {
+			return nil, err
+		}
+		add(Source{Type: SourceGroup, Name: group.Name}, granted)
+	}
+	for i := range grants {
+		grants[i].Effect = summarizeEffect(grants[i].Sources)
+	}
+	return &Resolution{User: user, Roles: roles, Groups: groups, Grants: grants}, nil
+}
+
+func summarizeEffect(sources []Source) string {
+
+	effect := EffectConditional
+	for _, source := range sources {
+		if len(source.Condition) > 0 {
+			continue
+		}
+		if source.Effect == models.EffectDeny {
+			return models.EffectDeny
+		}
+		effect = models.EffectAllow
+	}
+	return effect
+}
+
+func ResolveGrants(username string) ([]Grant, error) {
+
+	resolution, err := Resolve(username)
+	if err != nil {
+		return nil, err
+	}
+	return resolution.Grants, nil
+}
+
+// EffectivePermissions returns the distinct permissions unconditionally allowed to the user.
+func EffectivePermissions(username string) ([]models.Permission, error) {
+
+	grants, err := ResolveGrants(username)
+	if err != nil {
+		return nil, err
+	}
+	permissions := []models.Permission{}
+	for _, grant := range grants {
+		if grant.Effect == models.EffectAllow {
+			permissions = append(permissions, grant.Permission)
+		}
+	}
+	return permissions, nil
+}
+
+// Subject returns the attributes conditions can refer to as subject.
+func (resolution *Resolution) Subject() Attributes {
+
+	roles := []interface{}{}
+	for _, role := range resolution.Roles {
+		roles = append(roles, role.Name)
+	}
+	groups := []interface{}{}
+	for _, group := range resolution.Groups {
+		groups = append(groups, group.Name)
+	}
+	return Attributes{
+		"username": resolution.User.Username,
+		"email":    resolution.User.Email,
+		"is_admin": resolution.User.IsAdmin,
+		"roles":    roles,
+		"groups":   groups,
+	}
+}
+
+// Grant returns the grant of the operation on the table, if the resolved user holds any.
+func (resolution *Resolution) Grant(table string, operation string) (Grant, bool) {
+
+	for _, grant := range resolution.Grants {
+		if grant.Permission.Table == table && strings.EqualFold(grant.Permission.Operation, operation) {
+			return grant, true
+		}
+	}
+	return Grant{}, false
+}
+
+// holds evaluates the condition of source against resource. A condition that fails to evaluate fails
+// closed: a broken deny still applies, a broken allow doesn't.
+func (resolution *Resolution) holds(source Source, resource Attributes) bool {
+
+	holds, err := EvaluateCondition(source.Condition, resolution.Subject(), resource)
+	if err != nil {
+		fmt.Printf("Couldn't evaluate condition %q: %s\n", source.Condition, err.Error())
+		return source.Effect == models.EffectDeny
+	}
+	return holds
+}
+
+// Denial reports the deny keeping the resolved user from performing the operation on the table, if any.
+// Without a resource, a conditional deny applies too, as it may hold for any object of the table.
+func (resolution *Resolution) Denial(table string, operation string, resource Attributes) (Decision, bool) {
+
+	name := PermissionName(table, operation)
+	if !resolution.User.IsActive {
+		return Decision{Allowed: false, Reason: fmt.Sprintf("%s is inactive", resolution.User.Username)}, true
+	}
+	if resolution.User.IsAdmin {
+		return Decision{}, false
+	}
+	grant, ok := resolution.Grant(table, operation)
+	if !ok {
+		return Decision{}, false
+	}
+	for _, source := range grant.Sources {
+		if source.Effect != models.EffectDeny {
+			continue
+		}
+		if len(source.Condition) == 0 {
+			return Decision{Allowed: false, Reason: fmt.Sprintf("%s is denied by %s", name, source)}, true
+		}
+		if resource == nil {
+			return Decision{Allowed: false, Reason: fmt.Sprintf("%s is denied by %s where %s", name, source, source.Condition)}, true
+		}
+		if resolution.holds(source, resource) {
+			return Decision{Allowed: false, Reason: fmt.Sprintf("%s is denied by %s", name, source)}, true
+		}
+	}
+	return Decision{}, false
+}
+
+// Decide checks whether the resolved user may perform the operation on the table. Any applicable deny beats
+// every allow. Without a resource, conditional allows don't apply while conditional denies do, see Denial.
+func (resolution *Resolution) Decide(table string, operation string, resource Attributes) Decision {
+
+	name := PermissionName(table, operation)
+	if decision, denied := resolution.Denial(table, operation, resource); denied {
+		return decision
+	}
+	if resolution.User.IsAdmin {
+		return Decision{Allowed: true, Reason: fmt.Sprintf("%s is an admin", resolution.User.Username)}
+	}
+	grant, ok := resolution.Grant(table, operation)
+	if !ok {
+		return Decision{Allowed: false, Reason: fmt.Sprintf("No role or group grants %s", name)}
+	}
+	for _, source := range grant.Sources {
+		if source.Effect == models.EffectDeny {
+			continue
+		}
+		if len(source.Condition) > 0 && (resource == nil || !resolution.holds(source, resource)) {
+			continue
+		}
+		return Decision{Allowed: true, Reason: fmt.Sprintf("%s is granted by %s", name, source)}
+	}
+	return Decision{Allowed: false, Reason: fmt.Sprintf("No role or group grants %s", name)}
+}
+
+// Decide resolves the user and checks whether it may perform the operation on the table,
+// evaluating conditions against resource when one is given.
+func Decide(username string, table string, operation string, resource Attributes) (Decision, error) {
+
+	resolution, err := Resolve(username)
+	if err != nil {
+		return Decision{}, err
+	}
+	return resolution.Decide(table, operation, resource), nil
+}
+
+// HasPermission reports whether the user may perform the operation on the table as a whole.
+func HasPermission(username string, table string, operation string) (bool, error) {
+
+	decision, err := Decide(username, table, operation, nil)
+	if err != nil {
+		return false, err
+	}
+	return decision.Allowed, nil
+}
@@ -0,0 +1,181 @@
+package authz
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+)
+
+func TaskAttributes(task models.Task) Attributes {
+
+	asignees := []interface{}{}
+	for _, asignee := range task.Asignees {
+		asignees = append(asignees, asignee.Username)
+	}
+	return Attributes{
+		"id":          task.ID,
+		"name":        task.Name,
+		"description": task.Description,
+		"creator":     task.Creator,
+		"status":      task.Status,
+		"priority":    task.Priority,
+		"asignees":    asignees,
+	}
+}
+
+// VisibleTasks restricts a query on tasks to those username created or is assigned, and those created by or
+// assigned to someone sharing a group with username. Only memberships active at now count.
+func VisibleTasks(username string, now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		members := initializers.DB.Table("user_groups AS theirs").Select("theirs.user_username").
+			Joins("JOIN user_groups AS mine ON mine.group_id = theirs.group_id").
+			Where("mine.user_username = ?", username).
+			Scopes(ActiveMembership("mine", now), ActiveMembership("theirs", now))
+		assigned := initializers.DB.Table("task_asignees").Select("task_id").
+			Where("user_username = ? OR user_username IN (?)", username, members)
+		return db.Where("tasks.creator = ? OR tasks.creator IN (?) OR tasks.id IN (?)", username, members, assigned)
+	}
+}
+
+// CanReadTask reports whether username may read task: anyone granted read_tasks unconditionally, anyone
+// the task is visible to and anyone with a read_tasks grant holding for it, unless a deny applies.
+func CanReadTask(username string, task models.Task) (Decision, error) {
+	return DecideTask(username, "READ", task, RelationVisible)
+}
+
+// ReadableTasks keeps the tasks out of tasks that username may read, see CanReadTask.
+func ReadableTasks(username string, tasks []models.Task) ([]models.Task, error) {
+
+	resolution, err := Resolve(username)
+	if err != nil {
+		return nil, err
+	}
+	ids := []uint{}
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+	var visible []uint
+	if len(ids) > 0 {
+		result := initializers.DB.Model(&models.Task{}).Where("tasks.id IN ?", ids).
+			Scopes(VisibleTasks(username, time.Now())).Pluck("tasks.id", &visible)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+	}
+	isVisible := map[uint]bool{}
+	for _, id := range visible {
+		isVisible[id] = true
+	}
+	readable := []models.Task{}
+	for _, task := range tasks {
+		if resolution.canReadTask(task, isVisible[task.ID]).Allowed {
+			readable = append(readable, task)
+		}
+	}
+	return readable, nil
+}
+
+func (resolution *Resolution) canReadTask(task models.Task, visible bool) Decision {
+
+	relation := ""
+	if visible {
+		relation = fmt.Sprintf("Task %d is visible to %s", task.ID, resolution.User.Username)
+	}
+	return resolution.decideRelated("tasks", "READ", TaskAttributes(task), relation)
+}
+
+// DecideTask is Decide for task, where relations name how username may be related to the task to perform the
+// operation without a grant. Denies apply to related users all the same.
+func DecideTask(username string, operation string, task models.Task, relations ...string) (Decision, error) {
+
+	resolution, err := Resolve(username)
+	if err != nil {
+		return Decision{}, err
+	}
+	relation := ""
+	for _, candidate := range relations {
+		switch candidate {
+		case RelationCreator:
+			if task.Creator == username {
+				relation = fmt.Sprintf("%s created task %d", username, task.ID)
+			}
+		case RelationAsignee:
+			for _, asignee := range task.Asignees {
+				if asignee.Username == username {
+					relation = fmt.Sprintf("Task %d is assigned to %s", task.ID, username)
+				}
+			}
+		case RelationVisible:
+			var visible int64
+			result := initializers.DB.Model(&models.Task{}).Where("tasks.id = ?", task.ID).
+				Scopes(VisibleTasks(username, time.Now())).Count(&visible)
+			if result.Error != nil {
+				return Decision{}, result.Error
+			}
+			if visible > 0 {
+				relation = fmt.Sprintf("Task %d is visible to %s", task.ID, username)
+			}
+		}
+		if len(relation) > 0 {
+			break
+		}
+	}
+	return resolution.decideRelated("tasks", strings.ToUpper(operation), TaskAttributes(task), relation), nil
+}
+
+// decideRelated is Decide for a user related to resource, where relation is the reason the relation lets them
+// perform the operation, or empty when they aren't related. Only denies are checked before the relation.
+func (resolution *Resolution) decideRelated(table string, operation string, resource Attributes, relation string) Decision {
+
+	if decision, denied := resolution.Denial(table, operation, resource); denied {
+		return decision
+	}
+	if len(relation) > 0 && !resolution.User.IsAdmin {
+		return Decision{Allowed: true, Reason: relation}
+	}
+	return resolution.Decide(table, operation, resource)
+}
+
+func UserAttributes(user models.User) Attributes {
+
+	groups := []interface{}{}
+	for _, group := range user.Groups {
+		groups = append(groups, group.Name)
+	}
+	roles := []interface{}{}
+	for _, role := range user.Roles {
+		roles = append(roles, role.Name)
+	}
+	return Attributes{
+		"username":  user.Username,
+		"email":     user.Email,
+		"is_active": user.IsActive,
+		"is_admin":  user.IsAdmin,
+		"groups":    groups,
+		"roles":     roles,
+	}
+}
+
+// LoadResource loads the attributes of a single object of a table, identified the way its routes identify it.
+func LoadResource(table string, id string) (Attributes, error) {
+
+	switch table {
+	case "tasks":
+		var task models.Task
+		if result := initializers.DB.Preload("Asignees").Take(&task, "id = ?", id); result.Error != nil {
+			return nil, result.Error
+		}
+		return TaskAttributes(task), nil
+	case "users":
+		var user models.User
+		if result := initializers.DB.Preload("Roles").Preload("Groups").Take(&user, "username = ?", id); result.Error != nil {
+			return nil, result.Error
+		}
+		return UserAttributes(user), nil
+	}
+	return nil, fmt.Errorf("no attributes for %s resources", table)
+}
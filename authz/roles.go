@@ -0,0 +1,74 @@
+package authz
+
+import (
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+)
+
+// RoleLink is a role reached while walking up an inheritance hierarchy. Via holds the names
+// of the roles passed through on the way, starting with the role the walk began at.
+type RoleLink struct {
+	Role        models.Role
+	Permissions []GrantedPermission
+	Via         []string
+}
+
+// RoleChain returns the role followed by all of its ancestors, each with its permissions loaded.
+func RoleChain(name string) ([]RoleLink, error) {
+	return roleChain(name, nil)
+}
+
+func roleChain(name string, scenario *Scenario) ([]RoleLink, error) {
+
+	var role models.Role
+	if result := initializers.DB.Preload("Parents").Take(&role, "name = ?", name); result.Error != nil {
+		return nil, result.Error
+	}
+	permissions, err := scenario.rolePermissions(role.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := []RoleLink{{Role: role, Permissions: permissions}}
+	visited := map[uint]bool{role.ID: true}
+	for i := 0; i < len(chain); i++ {
+		via := append(append([]string{}, chain[i].Via...), chain[i].Role.Name)
+		for _, parent := range chain[i].Role.Parents {
+			if visited[parent.ID] {
+				continue
+			}
+			visited[parent.ID] = true
+
+			var ancestor models.Role
+			if result := initializers.DB.Preload("Parents").Take(&ancestor, "id = ?", parent.ID); result.Error != nil {
+				return nil, result.Error
+			}
+			permissions, err := scenario.rolePermissions(ancestor.ID)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, RoleLink{Role: ancestor, Permissions: permissions, Via: via})
+		}
+	}
+	return chain, nil
+}
+
+// CreatesRoleCycle reports whether making parents the parents of role would create an inheritance cycle.
+func CreatesRoleCycle(role models.Role, parents []models.Role) (bool, error) {
+
+	for _, parent := range parents {
+		if parent.ID == role.ID {
+			return true, nil
+		}
+		chain, err := RoleChain(parent.Name)
+		if err != nil {
+			return false, err
+		}
+		for _, link := range chain {
+			if link.Role.ID == role.ID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
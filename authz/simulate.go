@@ -0,0 +1,196 @@
+package authz
+
+import (
+	"sort"
+
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+)
+
+// Scenario is a proposed change to the permissions or members of a single role or group. It is only
+// ever applied in memory while resolving permissions. A nil Permissions or Members leaves that part unchanged.
+type Scenario struct {
+	Type        string
+	Role        models.Role
+	Group       models.Group
+	Permissions []GrantedPermission
+	Members     map[string]bool
+}
+
+// UserImpact is how a scenario changes what a single user may do.
+type UserImpact struct {
+	Username          string      `json:"username"`
+	GainedPermissions []string    `json:"gained_permissions"`
+	LostPermissions   []string    `json:"lost_permissions"`
+	GainedRoutes      []RouteRule `json:"gained_routes"`
+	LostRoutes        []RouteRule `json:"lost_routes"`
+}
+
+func (scenario *Scenario) rolePermissions(roleID uint) ([]GrantedPermission, error) {
+	if scenario != nil && scenario.Type == SourceRole && scenario.Role.ID == roleID && scenario.Permissions != nil {
+		return scenario.Permissions, nil
+	}
+	return RolePermissions(roleID)
+}
+
+func (scenario *Scenario) groupPermissions(groupID uint) ([]GrantedPermission, error) {
+	if scenario != nil && scenario.Type == SourceGroup && scenario.Group.ID == groupID && scenario.Permissions != nil {
+		return scenario.Permissions, nil
+	}
+	return GroupPermissions(groupID)
+}
+
+func (scenario *Scenario) memberships(username string, roles []models.Role, groups []models.Group) ([]models.Role, []models.Group) {
+
+	if scenario == nil || scenario.Members == nil {
+		return roles, groups
+	}
+	wanted := scenario.Members[username]
+	switch scenario.Type {
+	case SourceRole:
+		kept := []models.Role{}
+		for _, role := range roles {
+			if role.ID != scenario.Role.ID {
+				kept = append(kept, role)
+			}
+		}
+		if wanted {
+			kept = append(kept, scenario.Role)
+		}
+		return kept, groups
+	case SourceGroup:
+		kept := []models.Group{}
+		for _, group := range groups {
+			if group.ID != scenario.Group.ID {
+				kept = append(kept, group)
+			}
+		}
+		if wanted {
+			kept = append(kept, scenario.Group)
+		}
+		return roles, kept
+	}
+	return roles, groups
+}
+
+// affectedUsers lists everyone whose permissions may change: current members of the role or group, members of
+// roles inheriting from the role, and the proposed members.
+func (scenario *Scenario) affectedUsers() ([]string, error) {
+
+	usernames := map[string]bool{}
+	for username := range scenario.Members {
+		usernames[username] = true
+	}
+
+	switch scenario.Type {
+	case SourceRole:
+		var roles []models.Role
+		if result := initializers.DB.Find(&roles); result.Error != nil {
+			return nil, result.Error
+		}
+		roleIDs := []uint{}
+		for _, role := range roles {
+			chain, err := RoleChain(role.Name)
+			if err != nil {
+				return nil, err
+			}
+			for _, link := range chain {
+				if link.Role.ID == scenario.Role.ID {
+					roleIDs = append(roleIDs, role.ID)
+					break
+				}
+			}
+		}
+		var links []models.UserRole
+		if result := initializers.DB.Find(&links, "role_id IN ?", roleIDs); result.Error != nil {
+			return nil, result.Error
+		}
+		for _, link := range links {
+			usernames[link.UserUsername] = true
+		}
+	case SourceGroup:
+		var links []models.UserGroup
+		if result := initializers.DB.Find(&links, "group_id = ?", scenario.Group.ID); result.Error != nil {
+			return nil, result.Error
+		}
+		for _, link := range links {
+			usernames[link.UserUsername] = true
+		}
+	}
+
+	sorted := []string{}
+	for username := range usernames {
+		sorted = append(sorted, username)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// Simulate resolves every affected user with and without the scenario and reports what changes.
+// Users whose permissions and reachable routes stay the same are left out.
+func Simulate(scenario *Scenario) ([]UserImpact, error) {
+
+	usernames, err := scenario.affectedUsers()
+	if err != nil {
+		return nil, err
+	}
+	rules := RouteRules()
+
+	impacts := []UserImpact{}
+	for _, username := range usernames {
+		before, err := resolve(username, nil)
+		if err != nil {
+			return nil, err
+		}
+		after, err := resolve(username, scenario)
+		if err != nil {
+			return nil, err
+		}
+
+		impact := UserImpact{
+			Username:          username,
+			GainedPermissions: []string{},
+			LostPermissions:   []string{},
+			GainedRoutes:      []RouteRule{},
+			LostRoutes:        []RouteRule{},
+		}
+		allowedBefore, allowedAfter := before.allowed(), after.allowed()
+		for name := range allowedAfter {
+			if !allowedBefore[name] {
+				impact.GainedPermissions = append(impact.GainedPermissions, name)
+			}
+		}
+		for name := range allowedBefore {
+			if !allowedAfter[name] {
+				impact.LostPermissions = append(impact.LostPermissions, name)
+			}
+		}
+		sort.Strings(impact.GainedPermissions)
+		sort.Strings(impact.LostPermissions)
+		for _, rule := range rules {
+			reachedBefore, reachedAfter := before.CanReach(rule), after.CanReach(rule)
+			if reachedAfter && !reachedBefore {
+				impact.GainedRoutes = append(impact.GainedRoutes, rule)
+			}
+			if reachedBefore && !reachedAfter {
+				impact.LostRoutes = append(impact.LostRoutes, rule)
+			}
+		}
+
+		if len(impact.GainedPermissions)+len(impact.LostPermissions)+len(impact.GainedRoutes)+len(impact.LostRoutes) > 0 {
+			impacts = append(impacts, impact)
+		}
+	}
+	return impacts, nil
+}
+
+func (resolution *Resolution) allowed() map[string]bool {
+
+	allowed := map[string]bool{}
+	for _, grant := range resolution.Grants {
+		if resolution.User.IsAdmin || grant.Effect == models.EffectAllow {
+			allowed[grant.Permission.Name] = true
+		}
+	}
+	return allowed
+}
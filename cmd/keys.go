@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/spf13/cobra"
+)
+
+var rotateKeysCommand = &cobra.Command{
+	Use:   "rotate-keys",
+	Short: "This command can be used to rotate the keys signing access tokens.",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Rotating signing keys...")
+		key, err := tokens.RotateKeys()
+		if err != nil {
+			fmt.Printf("Couldn't rotate signing keys: %s", err.Error())
+			return
+		}
+		fmt.Printf("Successfully rotated signing keys, new key %s\n", key.KID)
+	},
+}
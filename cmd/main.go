@@ -5,10 +5,20 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
 	"github.com/guptaharsh13/balkanid-task/config"
 	"github.com/guptaharsh13/balkanid-task/controllers"
+	"github.com/guptaharsh13/balkanid-task/federation"
 	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/jobs"
+	"github.com/guptaharsh13/balkanid-task/lockout"
+	"github.com/guptaharsh13/balkanid-task/mailer"
+	"github.com/guptaharsh13/balkanid-task/notify"
+	"github.com/guptaharsh13/balkanid-task/oauth"
+	"github.com/guptaharsh13/balkanid-task/reminders"
 	"github.com/guptaharsh13/balkanid-task/routes"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/guptaharsh13/balkanid-task/twofactor"
 	"github.com/guptaharsh13/balkanid-task/utils"
 	"github.com/spf13/cobra"
 )
@@ -22,6 +32,27 @@ func init() {
 	initializers.ConnectToDb(configuration.DB)
 	initializers.SyncDatabase()
 	initializers.SyncPermissions()
+	initializers.SyncWorkflow()
+	tokens.Configure(configuration.Tokens.AccessTTL, configuration.Tokens.RefreshTTL, configuration.Tokens.ResetTTL)
+	if err := tokens.ConfigureKeys(configuration.Tokens.SigningAlgorithm, configuration.Tokens.KeyOverlap); err != nil {
+		panic(fmt.Sprintf("Couldn't setup signing keys: %s", err))
+	}
+	fmt.Println("✅ Signing Keys Loaded")
+	lockout.Configure(configuration.Lockout.MaxAccountFailures, configuration.Lockout.MaxIPFailures,
+		configuration.Lockout.Duration, configuration.Lockout.FailureWindow)
+	twofactor.Configure(configuration.TwoFactor.Issuer, configuration.TwoFactor.RequireForAdmins, configuration.TwoFactor.ChallengeTTL)
+	oauth.Configure(configuration.OAuth.Issuer, configuration.OAuth.CodeTTL)
+	federation.Configure(configuration.Federation)
+	if err := mailer.Configure(configuration.Mail); err != nil {
+		panic(fmt.Sprintf("Couldn't setup mailer: %s", err))
+	}
+	if err := notify.Configure(configuration.Reminders.Notifier); err != nil {
+		panic(fmt.Sprintf("Couldn't setup notifier: %s", err))
+	}
+	reminders.Configure(configuration.Reminders.LeadTime)
+	if err := authz.SetupCache(configuration.AuthzCacheTTL); err != nil {
+		fmt.Println("❌ Couldn't setup authorization cache")
+	}
 	err := utils.SetupValidator()
 	if err != nil {
 		fmt.Println("❌ Couldn't setup validator")
@@ -45,6 +76,18 @@ func StartApp() error {
 	routes.TaskRouter(r)
 	routes.GroupRouter(r)
 	routes.RoleRouter(r)
+	routes.PermissionRouter(r)
+	routes.AuthzRouter(r)
+	routes.KeyRouter(r)
+	routes.ServiceAccountRouter(r)
+	routes.OAuthRouter(r)
+	routes.FederationRouter(r)
+	routes.WorkflowRouter(r)
+
+	jobs.StartMembershipSweeper(configuration.Jobs.MembershipSweepInterval)
+	jobs.StartTokenSweeper(configuration.Jobs.TokenSweepInterval)
+	jobs.StartMailQueue(configuration.Jobs.MailQueueInterval)
+	jobs.StartReminderScheduler(configuration.Jobs.ReminderInterval)
 
 	if err := r.Run(); err != nil {
 		return fmt.Errorf("couldn't start the server: %s", err.Error())
@@ -67,6 +110,7 @@ func main() {
 	}
 
 	rootCmd.AddCommand(adminCommand)
+	rootCmd.AddCommand(rotateKeysCommand)
 
 	if err := rootCmd.Execute(); err != nil {
 		panic(err)
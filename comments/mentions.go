@@ -0,0 +1,99 @@
+package comments
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/guptaharsh13/balkanid-task/authz"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/mailer"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/notify"
+)
+
+// mentionPattern matches @username where the @ doesn't continue a word, so email addresses aren't mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([\w.-]+)`)
+
+// ParseMentions returns the distinct usernames mentioned in body, in order of appearance.
+func ParseMentions(body string) []string {
+
+	usernames := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		// A mention ending a sentence shouldn't take the full stop along.
+		username := strings.TrimRight(match[1], ".-")
+		if len(username) == 0 || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// Mentions resolves the users mentioned in body. Mentions of users that don't exist are left as plain text.
+func Mentions(body string) ([]models.User, error) {
+
+	usernames := ParseMentions(body)
+	users := []models.User{}
+	if len(usernames) == 0 {
+		return users, nil
+	}
+	if result := initializers.DB.Find(&users, "username IN ?", usernames); result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+// MentionData is what the comment_mention template is rendered with.
+type MentionData struct {
+	Username string
+	Author   string
+	TaskName string
+	Body     string
+	Link     string
+}
+
+// NotifyMentions tells the users mentioned in comment about it, except its author and users who can't read
+// task, since the notification quotes it. Failures are logged, the comment stands regardless.
+func NotifyMentions(task models.Task, comment models.TaskComment, users []models.User) {
+
+	for _, user := range users {
+		if user.Username == comment.Author || !user.IsActive {
+			continue
+		}
+		decision, err := authz.CanReadTask(user.Username, task)
+		if err != nil {
+			fmt.Printf("Couldn't check whether %s can read task %d: %s\n", user.Username, task.ID, err.Error())
+			continue
+		}
+		if !decision.Allowed {
+			continue
+		}
+		err = notify.Send(notify.Notification{
+			User:     user,
+			Template: mailer.TemplateCommentMention,
+			Data: MentionData{
+				Username: user.Username,
+				Author:   comment.Author,
+				TaskName: task.Name,
+				Body:     comment.Body,
+				Link:     fmt.Sprintf("%s/tasks/%d#comment-%d", mailer.AppURL(), task.ID, comment.ID),
+			},
+		})
+		if err != nil {
+			fmt.Printf("Couldn't notify %s of a mention: %s\n", user.Username, err.Error())
+		}
+	}
+}
+
+// Mentioned turns the users mentioned in a comment into its mention rows.
+func Mentioned(users []models.User) []models.TaskCommentMention {
+
+	mentions := []models.TaskCommentMention{}
+	for _, user := range users {
+		mentions = append(mentions, models.TaskCommentMention{UserID: user.Username})
+	}
+	return mentions
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,6 +15,15 @@ type Config struct {
 	Environment    string
 	TrustedProxies []string
 	DB             DBConfig
+	Jobs           JobsConfig
+	AuthzCacheTTL  time.Duration
+	Tokens         TokensConfig
+	TwoFactor      TwoFactorConfig
+	Lockout        LockoutConfig
+	OAuth          OAuthConfig
+	Federation     FederationConfig
+	Mail           MailConfig
+	Reminders      RemindersConfig
 }
 
 type DBConfig struct {
@@ -25,6 +35,77 @@ type DBConfig struct {
 	SSLMode  string
 }
 
+type TwoFactorConfig struct {
+	Issuer           string
+	RequireForAdmins bool
+	ChallengeTTL     time.Duration
+}
+
+type LockoutConfig struct {
+	MaxAccountFailures uint
+	MaxIPFailures      uint
+	Duration           time.Duration
+	FailureWindow      time.Duration
+}
+
+type OAuthConfig struct {
+	Issuer  string
+	CodeTTL time.Duration
+}
+
+// FederationConfig is the external OpenID Connect identity provider users can log in through.
+// Federated login is off while Issuer is empty.
+type FederationConfig struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURI   string
+	Scopes        []string
+	GroupsClaim   string
+	AutoProvision bool
+	LoginTTL      time.Duration
+}
+
+// MailConfig picks the backend emails are sent with: smtp, file (writes .eml files to Dir) or memory.
+type MailConfig struct {
+	Backend     string
+	From        string
+	Dir         string
+	SMTP        SMTPConfig
+	MaxAttempts uint
+	// AppURL is where links in emails point to. ResetURL is the page users reset their password on.
+	AppURL   string
+	ResetURL string
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     uint
+	Username string
+	Password string
+}
+
+// RemindersConfig is when asignees are reminded of due tasks and how: mail or log.
+type RemindersConfig struct {
+	LeadTime time.Duration
+	Notifier string
+}
+
+type JobsConfig struct {
+	MembershipSweepInterval time.Duration
+	TokenSweepInterval      time.Duration
+	MailQueueInterval       time.Duration
+	ReminderInterval        time.Duration
+}
+
+type TokensConfig struct {
+	AccessTTL        time.Duration
+	RefreshTTL       time.Duration
+	ResetTTL         time.Duration
+	SigningAlgorithm string
+	KeyOverlap       time.Duration
+}
+
 func findEnvironment() string {
 	if flag.Lookup("test.v") == nil {
 		env := os.Getenv("GO_ENV")
@@ -50,6 +131,63 @@ func LoadConfig() *Config {
 			Port:     getEnvAsUint("DB_PORT", 3000),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
+		Jobs: JobsConfig{
+			MembershipSweepInterval: time.Duration(getEnvAsUint("MEMBERSHIP_SWEEP_INTERVAL", 300)) * time.Second,
+			TokenSweepInterval:      time.Duration(getEnvAsUint("TOKEN_SWEEP_INTERVAL", 3600)) * time.Second,
+			MailQueueInterval:       time.Duration(getEnvAsUint("MAIL_QUEUE_INTERVAL", 30)) * time.Second,
+			ReminderInterval:        time.Duration(getEnvAsUint("REMINDER_INTERVAL", 300)) * time.Second,
+		},
+		AuthzCacheTTL: time.Duration(getEnvAsUint("AUTHZ_CACHE_TTL", 5)) * time.Second,
+		Tokens: TokensConfig{
+			AccessTTL:        time.Duration(getEnvAsUint("ACCESS_TOKEN_TTL", 900)) * time.Second,
+			RefreshTTL:       time.Duration(getEnvAsUint("REFRESH_TOKEN_TTL", 2592000)) * time.Second,
+			ResetTTL:         time.Duration(getEnvAsUint("PASSWORD_RESET_TTL", 3600)) * time.Second,
+			SigningAlgorithm: getEnv("JWT_ALGORITHM", "EdDSA"),
+			KeyOverlap:       time.Duration(getEnvAsUint("JWT_KEY_OVERLAP", 86400)) * time.Second,
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer:           getEnv("TOTP_ISSUER", "balkanid-task"),
+			RequireForAdmins: getEnvAsBool("REQUIRE_2FA_FOR_ADMINS", true),
+			ChallengeTTL:     time.Duration(getEnvAsUint("LOGIN_CHALLENGE_TTL", 300)) * time.Second,
+		},
+		Lockout: LockoutConfig{
+			MaxAccountFailures: getEnvAsUint("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+			MaxIPFailures:      getEnvAsUint("LOGIN_MAX_IP_FAILURES", 20),
+			Duration:           time.Duration(getEnvAsUint("LOGIN_LOCKOUT_DURATION", 900)) * time.Second,
+			FailureWindow:      time.Duration(getEnvAsUint("LOGIN_FAILURE_WINDOW", 900)) * time.Second,
+		},
+		OAuth: OAuthConfig{
+			Issuer:  getEnv("OIDC_ISSUER", "http://localhost:3000"),
+			CodeTTL: time.Duration(getEnvAsUint("OAUTH_CODE_TTL", 60)) * time.Second,
+		},
+		Federation: FederationConfig{
+			Issuer:        getEnv("IDP_ISSUER", ""),
+			ClientID:      getEnv("IDP_CLIENT_ID", ""),
+			ClientSecret:  getEnv("IDP_CLIENT_SECRET", ""),
+			RedirectURI:   getEnv("IDP_REDIRECT_URI", "http://localhost:3000/users/login/oidc/callback"),
+			Scopes:        strings.Fields(getEnv("IDP_SCOPES", "openid profile email groups")),
+			GroupsClaim:   getEnv("IDP_GROUPS_CLAIM", "groups"),
+			AutoProvision: getEnvAsBool("IDP_AUTO_PROVISION", true),
+			LoginTTL:      time.Duration(getEnvAsUint("IDP_LOGIN_TTL", 600)) * time.Second,
+		},
+		Mail: MailConfig{
+			Backend: getEnv("MAIL_BACKEND", "file"),
+			From:    getEnv("MAIL_FROM", "balkanid-task <no-reply@localhost>"),
+			Dir:     getEnv("MAIL_DIR", "mail"),
+			SMTP: SMTPConfig{
+				Host:     getEnv("SMTP_HOST", "localhost"),
+				Port:     getEnvAsUint("SMTP_PORT", 587),
+				Username: getEnv("SMTP_USERNAME", ""),
+				Password: getEnv("SMTP_PASSWORD", ""),
+			},
+			MaxAttempts: getEnvAsUint("MAIL_MAX_ATTEMPTS", 10),
+			AppURL:      getEnv("APP_URL", "http://localhost:3000"),
+			ResetURL:    getEnv("PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+		},
+		Reminders: RemindersConfig{
+			LeadTime: time.Duration(getEnvAsUint("REMINDER_LEAD_TIME", 86400)) * time.Second,
+			Notifier: getEnv("REMINDER_NOTIFIER", "mail"),
+		},
 	}
 	fmt.Println("✅ Config Loaded")
 	return &config
@@ -75,3 +213,16 @@ func getEnvAsUint(key string, defaultValue uint) uint {
 	}
 	return uint(uintValue)
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue
+	}
+	return boolValue
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/guptaharsh13/balkanid-task/utils"
+)
+
+func GetAPITokens(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+	getAPITokens(c, username.(string))
+}
+
+func CreateAPIToken(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+	var owner models.User
+	if result := initializers.DB.Take(&owner, "username = ?", username); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("User not found"))
+		return
+	}
+	createAPIToken(c, owner)
+}
+
+func RevokeAPIToken(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+	revokeAPIToken(c, username.(string))
+}
+
+func getAPITokens(c *gin.Context, username string) {
+
+	apiTokens, err := tokens.APITokens(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch api tokens: %s", err.Error())
+		return
+	}
+	data := struct {
+		Tokens []models.APIToken `json:"tokens"`
+	}{
+		Tokens: apiTokens,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// createAPIToken issues an API token of owner. It can only carry permissions both the owner and the caller hold.
+func createAPIToken(c *gin.Context, owner models.User) {
+
+	var body struct {
+		Name        string     `json:"name" validate:"required"`
+		Permissions []string   `json:"permissions" validate:"required,min=1"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+	if body.ExpiresAt != nil && body.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Expiry must be in the future"))
+		return
+	}
+
+	var permissions []models.Permission
+	result := initializers.DB.Where("name IN ?", body.Permissions).Find(&permissions)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	if result.RowsAffected != int64(len(body.Permissions)) {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Permissions not found"))
+		return
+	}
+	// The caller has to hold the permissions too, or minting a token of a service account would hand out
+	// whatever its roles grant to anyone allowed to manage it.
+	holders := []models.User{owner}
+	caller := c.GetString("username")
+	if caller != owner.Username {
+		holders = append(holders, models.User{Username: caller, IsAdmin: c.GetBool("is_admin")})
+	}
+	for _, holder := range holders {
+		if holder.IsAdmin {
+			continue
+		}
+		missing, err := missingPermissions(holder.Username, permissions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			fmt.Printf("Couldn't resolve permissions for %s: %s", holder.Username, err.Error())
+			return
+		}
+		if len(missing) > 0 {
+			c.JSON(http.StatusForbidden, utils.ForbiddenResponse(fmt.Sprintf("%s doesn't hold %s", holder.Username, strings.Join(missing, ", "))))
+			return
+		}
+	}
+
+	token, apiToken, err := tokens.IssueAPIToken(owner, body.Name, permissions, body.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't create api token: %s", err.Error())
+		return
+	}
+	data := struct {
+		Token    string          `json:"token"`
+		APIToken models.APIToken `json:"api_token"`
+	}{
+		Token:    token,
+		APIToken: apiToken,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// missingPermissions returns the names of the permissions username isn't granted.
+func missingPermissions(username string, permissions []models.Permission) ([]string, error) {
+
+	resolution, err := authz.Resolve(username)
+	if err != nil {
+		return nil, err
+	}
+	held := map[string]bool{}
+	for _, grant := range resolution.Grants {
+		if grant.Effect != models.EffectDeny {
+			held[grant.Permission.Name] = true
+		}
+	}
+	missing := []string{}
+	for _, permission := range permissions {
+		if !held[permission.Name] {
+			missing = append(missing, permission.Name)
+		}
+	}
+	return missing, nil
+}
+
+func revokeAPIToken(c *gin.Context, username string) {
+
+	id := c.Param("id")
+	if len(strings.TrimSpace(id)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("ID is required"))
+		return
+	}
+	revoked, err := tokens.RevokeAPIToken(username, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't revoke api token: %s", err.Error())
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse(fmt.Sprintf("Couldn't find active token with id %s", id)))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
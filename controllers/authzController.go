@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
+	"github.com/guptaharsh13/balkanid-task/middleware"
+	"github.com/guptaharsh13/balkanid-task/utils"
+	"gorm.io/gorm"
+)
+
+func CheckAuthorization(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+
+	var body struct {
+		Subject struct {
+			Username string `json:"username"`
+		} `json:"subject"`
+		Checks []struct {
+			Resource string `json:"resource" validate:"required"`
+			Action   string `json:"action" validate:"required"`
+			ID       string `json:"id"`
+		} `json:"checks" validate:"required,dive"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+
+	subject := username.(string)
+	if len(body.Subject.Username) > 0 && body.Subject.Username != subject {
+		caller, err := authz.Resolve(subject)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			return
+		}
+		if decision := caller.Decide("users", "READ", nil); !decision.Allowed || !middleware.ScopeAllows(c, "users", "READ") {
+			c.JSON(http.StatusForbidden, utils.ForbiddenResponse("Checking another user requires read_users"))
+			return
+		}
+		subject = body.Subject.Username
+	}
+
+	resolution, err := authz.Resolve(subject)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("User not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't resolve permissions: %s", err.Error())
+		return
+	}
+
+	type result struct {
+		Resource string `json:"resource"`
+		Action   string `json:"action"`
+		ID       string `json:"id,omitempty"`
+		Allowed  bool   `json:"allowed"`
+		Reason   string `json:"reason"`
+	}
+	results := []result{}
+	for _, check := range body.Checks {
+		action := strings.ToUpper(check.Action)
+		var resource authz.Attributes
+		if len(check.ID) > 0 {
+			resource, err = authz.LoadResource(check.Resource, check.ID)
+			if err != nil {
+				results = append(results, result{
+					Resource: check.Resource,
+					Action:   action,
+					ID:       check.ID,
+					Reason:   fmt.Sprintf("Couldn't load %s %s", check.Resource, check.ID),
+				})
+				continue
+			}
+		}
+		decision := resolution.Decide(check.Resource, action, resource)
+		// An API token checking its own user gets the answer its routes would give it.
+		if decision.Allowed && subject == username.(string) && !middleware.ScopeAllows(c, check.Resource, action) {
+			decision = authz.Decision{Allowed: false, Reason: fmt.Sprintf("API token lacks permission %s", authz.PermissionName(check.Resource, action))}
+		}
+		results = append(results, result{
+			Resource: check.Resource,
+			Action:   action,
+			ID:       check.ID,
+			Allowed:  decision.Allowed,
+			Reason:   decision.Reason,
+		})
+	}
+
+	data := struct {
+		Subject string   `json:"subject"`
+		Results []result `json:"results"`
+	}{
+		Subject: resolution.User.Username,
+		Results: results,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/comments"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/utils"
+	"gorm.io/gorm"
+)
+
+// takeReadableTask loads the task of the route and checks the caller may read it, which comments and the
+// activity feed of a task require.
+func takeReadableTask(c *gin.Context) (models.Task, bool) {
+
+	task, ok := takeTask(c)
+	if !ok {
+		return task, false
+	}
+	return task, authorizeTaskRead(c, task)
+}
+
+func takeComment(c *gin.Context, task models.Task) (models.TaskComment, bool) {
+
+	var comment models.TaskComment
+	id := c.Param("comment")
+	result := initializers.DB.Preload("Mentions").Limit(1).Find(&comment, "id = ? AND task_id = ? AND removed_at IS NULL", id, task.ID)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return comment, false
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse(fmt.Sprintf("Couldn't find comment with id %s", id)))
+		return comment, false
+	}
+	return comment, true
+}
+
+// CreateTaskComment comments on a task, or replies to a comment with parent_id. Replies to a reply join the
+// thread of the comment replied to. Users mentioned with @username are notified.
+func CreateTaskComment(c *gin.Context) {
+
+	task, ok := takeReadableTask(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Body     string `json:"body" validate:"required,max=10000"`
+		ParentID *uint  `json:"parent_id"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+	if len(strings.TrimSpace(body.Body)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Body must not be blank"))
+		return
+	}
+
+	parentID := body.ParentID
+	if parentID != nil {
+		var parent models.TaskComment
+		result := initializers.DB.Take(&parent, "id = ? AND task_id = ?", *parentID, task.ID)
+		if result.Error != nil {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse(fmt.Sprintf("Couldn't find comment with id %d", *parentID)))
+			return
+		}
+		if parent.RemovedAt != nil {
+			c.JSON(http.StatusConflict, utils.ConflictResponse("Can't reply to a removed comment"))
+			return
+		}
+		if parent.ParentID != nil {
+			parentID = parent.ParentID
+		}
+	}
+	users, err := comments.Mentions(body.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't resolve mentions: %s", err.Error())
+		return
+	}
+
+	comment := models.TaskComment{
+		TaskID:   task.ID,
+		ParentID: parentID,
+		Author:   c.GetString("username"),
+		Body:     body.Body,
+		Mentions: comments.Mentioned(users),
+	}
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TaskActivity{TaskID: task.ID, Actor: comment.Author, Kind: models.ActivityCommented, CommentID: &comment.ID}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't create comment: %s", err.Error())
+		return
+	}
+	comments.NotifyMentions(task, comment, users)
+
+	data := struct {
+		Comment models.TaskComment `json:"comment"`
+	}{
+		Comment: comment,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// GetTaskComments lists the threads on a task a page at a time, oldest first, each with its replies.
+func GetTaskComments(c *gin.Context) {
+
+	task, ok := takeReadableTask(c)
+	if !ok {
+		return
+	}
+	pagination, err := utils.ParsePagination(c.Query("page"), c.Query("per_page"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse(err.Error()))
+		return
+	}
+	query := initializers.DB.Model(&models.TaskComment{}).Where("task_id = ? AND parent_id IS NULL", task.ID).Session(&gorm.Session{})
+	if result := query.Count(&pagination.Total); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't count comments: %s", result.Error.Error())
+		return
+	}
+	var threads []models.TaskComment
+	result := query.Preload("Mentions").
+		Preload("Replies", func(db *gorm.DB) *gorm.DB { return db.Order("created_at").Order("id") }).
+		Preload("Replies.Mentions").
+		Order("created_at").Order("id").Offset(pagination.Offset()).Limit(pagination.PerPage).Find(&threads)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch comments: %s", result.Error.Error())
+		return
+	}
+	data := struct {
+		Comments   []models.TaskComment `json:"comments"`
+		Pagination utils.Pagination     `json:"pagination"`
+	}{
+		Comments:   threads,
+		Pagination: pagination,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// UpdateTaskComment edits the body of a comment. Only its author may, and only users newly mentioned
+// are notified.
+func UpdateTaskComment(c *gin.Context) {
+
+	task, ok := takeReadableTask(c)
+	if !ok {
+		return
+	}
+	comment, ok := takeComment(c, task)
+	if !ok {
+		return
+	}
+	if comment.Author != c.GetString("username") {
+		c.JSON(http.StatusForbidden, utils.ForbiddenResponse("Only the author may edit a comment"))
+		return
+	}
+	var body struct {
+		Body string `json:"body" validate:"required,max=10000"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+	if len(strings.TrimSpace(body.Body)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Body must not be blank"))
+		return
+	}
+	users, err := comments.Mentions(body.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't resolve mentions: %s", err.Error())
+		return
+	}
+	mentioned := map[string]bool{}
+	for _, mention := range comment.Mentions {
+		mentioned[mention.UserID] = true
+	}
+	newlyMentioned := []models.User{}
+	for _, user := range users {
+		if !mentioned[user.Username] {
+			newlyMentioned = append(newlyMentioned, user)
+		}
+	}
+
+	now := time.Now()
+	comment.Body = body.Body
+	comment.EditedAt = &now
+	comment.Mentions = comments.Mentioned(users)
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&comment).Select("body", "edited_at").Updates(&comment).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.TaskCommentMention{}, "comment_id = ?", comment.ID).Error; err != nil {
+			return err
+		}
+		if len(comment.Mentions) == 0 {
+			return nil
+		}
+		for i := range comment.Mentions {
+			comment.Mentions[i].CommentID = comment.ID
+		}
+		return tx.Create(&comment.Mentions).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't update comment: %s", err.Error())
+		return
+	}
+	comments.NotifyMentions(task, comment, newlyMentioned)
+
+	data := struct {
+		Comment models.TaskComment `json:"comment"`
+	}{
+		Comment: comment,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// DeleteTaskComment removes a comment, which its author and admins may do. A comment with replies is
+// emptied instead, and a removed comment goes away with its last reply.
+func DeleteTaskComment(c *gin.Context) {
+
+	task, ok := takeReadableTask(c)
+	if !ok {
+		return
+	}
+	comment, ok := takeComment(c, task)
+	if !ok {
+		return
+	}
+	if comment.Author != c.GetString("username") && !c.GetBool("is_admin") {
+		c.JSON(http.StatusForbidden, utils.ForbiddenResponse("Only the author may delete a comment"))
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var replies int64
+		if err := tx.Model(&models.TaskComment{}).Where("parent_id = ?", comment.ID).Count(&replies).Error; err != nil {
+			return err
+		}
+		if replies > 0 {
+			if err := tx.Delete(&models.TaskCommentMention{}, "comment_id = ?", comment.ID).Error; err != nil {
+				return err
+			}
+			return tx.Model(&comment).Updates(map[string]interface{}{"body": "", "removed_at": time.Now()}).Error
+		}
+		if err := tx.Delete(&comment).Error; err != nil {
+			return err
+		}
+		if comment.ParentID == nil {
+			return nil
+		}
+		// Removed threads only stay while they have replies.
+		return tx.Where("id = ? AND removed_at IS NOT NULL", *comment.ParentID).
+			Where("NOT EXISTS (?)", tx.Model(&models.TaskComment{}).Select("1").Where("parent_id = ?", *comment.ParentID)).
+			Delete(&models.TaskComment{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't delete comment: %s", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
+
+// GetTaskActivity returns the feed of a task a page at a time, newest first: its creation, edits, assignment
+// and status changes, and comments.
+func GetTaskActivity(c *gin.Context) {
+
+	task, ok := takeReadableTask(c)
+	if !ok {
+		return
+	}
+	pagination, err := utils.ParsePagination(c.Query("page"), c.Query("per_page"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse(err.Error()))
+		return
+	}
+	query := initializers.DB.Model(&models.TaskActivity{}).Where("task_id = ?", task.ID).Session(&gorm.Session{})
+	if result := query.Count(&pagination.Total); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't count task activity: %s", result.Error.Error())
+		return
+	}
+	var activities []models.TaskActivity
+	result := query.Preload("Comment").Preload("Comment.Mentions").Preload("StatusChange").
+		Order("created_at DESC").Order("id DESC").Offset(pagination.Offset()).Limit(pagination.PerPage).Find(&activities)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch task activity: %s", result.Error.Error())
+		return
+	}
+	data := struct {
+		Activity   []models.TaskActivity `json:"activity"`
+		Pagination utils.Pagination      `json:"pagination"`
+	}{
+		Activity:   activities,
+		Pagination: pagination,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/federation"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/utils"
+	"gorm.io/gorm"
+)
+
+// federatedLoginPath is where FederatedLogin and FederatedLoginCallback are served.
+const federatedLoginPath = "/users/login/oidc"
+
+// FederatedLogin sends the user to the identity provider, which redirects back to FederatedLoginCallback.
+func FederatedLogin(c *gin.Context) {
+
+	if !federation.Enabled() {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Federated login isn't configured"))
+		return
+	}
+	target, cookie, err := federation.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, utils.ErrorResponse(http.StatusBadGateway, "Couldn't reach the identity provider"))
+		fmt.Printf("Couldn't start federated login: %s", err.Error())
+		return
+	}
+	setCookie(c, federation.StateCookie, cookie, federatedLoginPath, time.Now().Add(federation.LoginTTL()), federation.SecureCookies())
+	c.Redirect(http.StatusFound, target)
+}
+
+func FederatedLoginCallback(c *gin.Context) {
+
+	if !federation.Enabled() {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Federated login isn't configured"))
+		return
+	}
+	if providerError := c.Query("error"); len(providerError) > 0 {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse(fmt.Sprintf("Identity provider refused the login: %s", providerError)))
+		return
+	}
+	state := c.Query("state")
+	code := c.Query("code")
+	if len(state) == 0 || len(code) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("state and code are required"))
+		return
+	}
+
+	// Without the cookie of FederatedLogin the callback was opened in another browser than the login started in.
+	cookie, _ := c.Cookie(federation.StateCookie)
+	setCookie(c, federation.StateCookie, "", federatedLoginPath, time.Unix(0, 0), federation.SecureCookies())
+	user, err := federation.Complete(state, code, cookie)
+	if err != nil {
+		switch {
+		case errors.Is(err, federation.ErrInvalidState):
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse(federation.Message(err)))
+		case errors.Is(err, federation.ErrUnverifiedEmail), errors.Is(err, federation.ErrUnverifiedUser):
+			c.JSON(http.StatusConflict, utils.ConflictResponse(federation.Message(err)))
+		case federation.Rejected(err):
+			c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse(federation.Message(err)))
+		default:
+			c.JSON(http.StatusBadGateway, utils.ErrorResponse(http.StatusBadGateway, "Couldn't complete login with the identity provider"))
+			fmt.Printf("Couldn't complete federated login: %s", err.Error())
+		}
+		return
+	}
+	completeLogin(c, user)
+}
+
+func CreateGroupMapping(c *gin.Context) {
+
+	var body struct {
+		Claim string `json:"claim" validate:"required"`
+		Kind  string `json:"kind" validate:"required,oneof=group role"`
+		Name  string `json:"name" validate:"required"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+	if _, err := path.Match(body.Claim, ""); err != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Invalid claim pattern"))
+		return
+	}
+	var result *gorm.DB
+	if body.Kind == models.MappingGroup {
+		result = initializers.DB.Take(&models.Group{}, "name = ?", body.Name)
+	} else {
+		result = initializers.DB.Take(&models.Role{}, "name = ?", body.Name)
+	}
+	if result.Error != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse(fmt.Sprintf("Couldn't find %s %s", body.Kind, body.Name)))
+		return
+	}
+	if result := initializers.DB.Take(&models.GroupMapping{}, "claim = ? AND kind = ? AND name = ?", body.Claim, body.Kind, body.Name); result.RowsAffected > 0 {
+		c.JSON(http.StatusConflict, utils.ConflictResponse("Mapping already exists"))
+		return
+	}
+
+	mapping := models.GroupMapping{Claim: body.Claim, Kind: body.Kind, Name: body.Name}
+	if result := initializers.DB.Create(&mapping); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't create group mapping: %s", result.Error.Error())
+		return
+	}
+	data := struct {
+		Mapping models.GroupMapping `json:"mapping"`
+	}{
+		Mapping: mapping,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func GetGroupMappings(c *gin.Context) {
+
+	var mappings []models.GroupMapping
+	if result := initializers.DB.Order("id").Find(&mappings); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch group mappings: %s", result.Error.Error())
+		return
+	}
+	data := struct {
+		Mappings []models.GroupMapping `json:"mappings"`
+	}{
+		Mappings: mappings,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// DeleteGroupMapping removes a mapping. Memberships it granted go away on the next federated login of each user.
+func DeleteGroupMapping(c *gin.Context) {
+
+	id := c.Param("id")
+	if len(strings.TrimSpace(id)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("ID is required"))
+		return
+	}
+	result := initializers.DB.Delete(&models.GroupMapping{}, "id = ?", id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't delete group mapping: %s", result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse(fmt.Sprintf("Couldn't find mapping with id %s", id)))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
+
+func GetFederatedIdentities(c *gin.Context) {
+
+	var identities []models.FederatedIdentity
+	if result := initializers.DB.Find(&identities, "user_id = ?", c.GetString("username")); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch federated identities: %s", result.Error.Error())
+		return
+	}
+	data := struct {
+		Identities []models.FederatedIdentity `json:"identities"`
+	}{
+		Identities: identities,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
@@ -2,14 +2,18 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
 	"github.com/guptaharsh13/balkanid-task/initializers"
 	"github.com/guptaharsh13/balkanid-task/models"
 	"github.com/guptaharsh13/balkanid-task/utils"
+	"gorm.io/gorm/clause"
 )
 
 func CreateGroup(c *gin.Context) {
@@ -102,10 +106,17 @@ func GetGroupByName(c *gin.Context) {
 		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find group"))
 		return
 	}
+	granted, err := authz.GroupPermissions(group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
 	data := struct {
-		Group models.Group `json:"group"`
+		Group              models.Group              `json:"group"`
+		GrantedPermissions []authz.GrantedPermission `json:"granted_permissions"`
 	}{
-		Group: group,
+		Group:              group,
+		GrantedPermissions: granted,
 	}
 	c.JSON(http.StatusOK, utils.SuccessResponse(data))
 }
@@ -301,6 +312,8 @@ func AddPermissionsToGroup(c *gin.Context) {
 
 	var body struct {
 		Permissions []string `json:"permissions"`
+		Effect      string   `json:"effect" validate:"omitempty,oneof=allow deny"`
+		Condition   string   `json:"condition"`
 	}
 	if c.Bind(&body) != nil {
 		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
@@ -322,15 +335,51 @@ func AddPermissionsToGroup(c *gin.Context) {
 		return
 	}
 
-	group.Permissions = append(group.Permissions, permissions...)
-	if result := initializers.DB.Save(&group); result.Error != nil {
+	effect := body.Effect
+	if len(effect) == 0 {
+		effect = models.EffectAllow
+	}
+	if len(body.Condition) > 0 {
+		if _, err := authz.CompileCondition(body.Condition); err != nil {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse(fmt.Sprintf("Invalid condition: %s", err.Error())))
+			return
+		}
+	}
+	links := []models.GroupPermission{}
+	for _, permission := range permissions {
+		links = append(links, models.GroupPermission{
+			GroupID:        group.ID,
+			GroupName:      group.Name,
+			PermissionID:   permission.ID,
+			PermissionName: permission.Name,
+			Effect:         effect,
+			Condition:      body.Condition,
+		})
+	}
+	if len(links) > 0 {
+		if result := initializers.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "group_id"}, {Name: "group_name"}, {Name: "permission_id"}, {Name: "permission_name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"effect", "condition"}),
+		}).Create(&links); result.Error != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			return
+		}
+	}
+	if result := initializers.DB.Preload("Permissions").Take(&group, group.ID); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	granted, err := authz.GroupPermissions(group.ID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
 		return
 	}
 	data := struct {
-		Group models.Group `json:"group"`
+		Group              models.Group              `json:"group"`
+		GrantedPermissions []authz.GrantedPermission `json:"granted_permissions"`
 	}{
-		Group: group,
+		Group:              group,
+		GrantedPermissions: granted,
 	}
 	c.JSON(http.StatusOK, utils.SuccessResponse(data))
 }
@@ -349,7 +398,9 @@ func AddUsersToGroup(c *gin.Context) {
 	}
 
 	var body struct {
-		Users []string `json:"users"`
+		Users      []string   `json:"users"`
+		ValidFrom  *time.Time `json:"valid_from"`
+		ValidUntil *time.Time `json:"valid_until"`
 	}
 	if c.Bind(&body) != nil {
 		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
@@ -360,6 +411,10 @@ func AddUsersToGroup(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
 		return
 	}
+	if body.ValidFrom != nil && body.ValidUntil != nil && !body.ValidUntil.After(*body.ValidFrom) {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("valid_until must be after valid_from"))
+		return
+	}
 	var users []models.User
 	result := initializers.DB.Where("username IN ?", body.Users).Find(&users)
 	if result.Error != nil {
@@ -371,15 +426,36 @@ func AddUsersToGroup(c *gin.Context) {
 		return
 	}
 
-	group.Users = append(group.Users, users...)
-	if result := initializers.DB.Save(&group); result.Error != nil {
+	memberships := []models.UserGroup{}
+	for _, user := range users {
+		memberships = append(memberships, models.UserGroup{
+			UserID:       user.ID,
+			UserUsername: user.Username,
+			GroupID:      group.ID,
+			GroupName:    group.Name,
+			ValidFrom:    body.ValidFrom,
+			ValidUntil:   body.ValidUntil,
+		})
+	}
+	if len(memberships) > 0 {
+		if result := initializers.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "user_username"}, {Name: "group_id"}, {Name: "group_name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"valid_from", "valid_until", "source"}),
+		}).Create(&memberships); result.Error != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			return
+		}
+	}
+	if result := initializers.DB.Preload("Users").Take(&group, group.ID); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
 		return
 	}
 	data := struct {
-		Group models.Group `json:"group"`
+		Group       models.Group       `json:"group"`
+		Memberships []models.UserGroup `json:"memberships"`
 	}{
-		Group: group,
+		Group:       group,
+		Memberships: memberships,
 	}
 	c.JSON(http.StatusOK, utils.SuccessResponse(data))
 }
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/guptaharsh13/balkanid-task/utils"
+)
+
+// GetJWKS serves the standard JWKS document rather than the usual response envelope,
+// so off-the-shelf JWT libraries can consume it.
+func GetJWKS(c *gin.Context) {
+
+	jwks, err := tokens.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't load signing keys: %s", err.Error())
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"keys": jwks,
+	})
+}
+
+func RotateSigningKeys(c *gin.Context) {
+
+	key, err := tokens.RotateKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't rotate signing keys: %s", err.Error())
+		return
+	}
+	data := struct {
+		Key models.SigningKey `json:"key"`
+	}{
+		Key: key,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/lockout"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/utils"
+)
+
+func GetLockouts(c *gin.Context) {
+
+	throttles, err := lockout.Locked(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch lockouts: %s", err.Error())
+		return
+	}
+	data := struct {
+		Lockouts []models.LoginThrottle `json:"lockouts"`
+	}{
+		Lockouts: throttles,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func UnlockUser(c *gin.Context) {
+
+	username := c.Param("username")
+	if len(strings.TrimSpace(username)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Username is required"))
+		return
+	}
+	unlocked, err := lockout.Unlock(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't unlock user: %s", err.Error())
+		return
+	}
+	if !unlocked {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("User isn't locked out"))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
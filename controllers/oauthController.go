@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/lockout"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/oauth"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/guptaharsh13/balkanid-task/twofactor"
+	"github.com/guptaharsh13/balkanid-task/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The endpoints relying parties talk to answer in the shapes of RFC 6749 and OpenID Connect rather than
+// the response envelope of the rest of the API, since that's what client libraries expect.
+
+func OpenIDConfiguration(c *gin.Context) {
+	c.JSON(http.StatusOK, oauth.Discovery())
+}
+
+// Authorize is the authorization endpoint. The user has to be signed in with the session cookie of the login
+// page; the code is handed to the client by redirecting to its redirect_uri.
+func Authorize(c *gin.Context) {
+
+	client, err := oauth.FindClient(c.Request.FormValue("client_id"))
+	if errors.Is(err, oauth.ErrInvalidClient) {
+		c.JSON(http.StatusBadRequest, &oauth.Error{Code: "invalid_request", Description: "Unknown client_id"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+		fmt.Printf("Couldn't fetch oauth client: %s", err.Error())
+		return
+	}
+	// Without a registered redirect_uri there's nowhere safe to send errors to.
+	redirectURI := c.Request.FormValue("redirect_uri")
+	if !client.AllowsRedirect(redirectURI) {
+		c.JSON(http.StatusBadRequest, &oauth.Error{Code: "invalid_request", Description: "redirect_uri isn't registered for the client"})
+		return
+	}
+	state := c.Request.FormValue("state")
+	redirect := func(params url.Values) {
+		if len(state) > 0 {
+			params.Set("state", state)
+		}
+		target, _ := url.Parse(redirectURI)
+		query := target.Query()
+		for key, values := range params {
+			query[key] = values
+		}
+		target.RawQuery = query.Encode()
+		c.Redirect(http.StatusFound, target.String())
+	}
+	redirectError := func(code string, description string) {
+		redirect(url.Values{"error": {code}, "error_description": {description}})
+	}
+
+	if c.Request.FormValue("response_type") != "code" {
+		redirectError("unsupported_response_type", "Only the code response type is supported")
+		return
+	}
+	scopes, err := oauth.ParseScope(c.Request.FormValue("scope"))
+	if err != nil {
+		var oauthErr *oauth.Error
+		errors.As(err, &oauthErr)
+		redirectError(oauthErr.Code, oauthErr.Description)
+		return
+	}
+	codeChallenge := c.Request.FormValue("code_challenge")
+	if len(codeChallenge) == 0 || c.Request.FormValue("code_challenge_method") != "S256" {
+		redirectError("invalid_request", "PKCE with code_challenge_method S256 is required")
+		return
+	}
+
+	// Browsers without a session sign in at the login page first, which sends them back here.
+	var user models.User
+	var authTime time.Time
+	cookie, err := c.Cookie(oauth.SessionCookie)
+	if err == nil {
+		user, authTime, err = oauth.BrowserSession(cookie)
+	}
+	if err != nil {
+		if err != http.ErrNoCookie && !tokens.Rejected(err) {
+			fmt.Printf("Couldn't check browser session: %s", err.Error())
+			redirectError("server_error", "Couldn't check the session")
+			return
+		}
+		c.Redirect(http.StatusFound, oauth.LoginURL("/oauth/authorize?"+c.Request.Form.Encode()))
+		return
+	}
+	code, err := oauth.IssueCode(oauth.AuthorizationRequest{
+		Client:        client,
+		User:          user,
+		RedirectURI:   redirectURI,
+		Scope:         strings.Join(scopes, " "),
+		Nonce:         c.Request.FormValue("nonce"),
+		CodeChallenge: codeChallenge,
+		AuthTime:      authTime,
+	})
+	if err != nil {
+		fmt.Printf("Couldn't issue authorization code: %s", err.Error())
+		redirectError("server_error", "Couldn't issue authorization code")
+		return
+	}
+	redirect(url.Values{"code": {code}})
+}
+
+// OAuthLoginPage serves the form browsers sign in with before the authorization endpoint issues a code.
+func OAuthLoginPage(c *gin.Context) {
+
+	returnTo := c.Query("return_to")
+	if !oauth.ValidReturnTo(returnTo) {
+		c.JSON(http.StatusBadRequest, &oauth.Error{Code: "invalid_request", Description: "return_to must be the authorization endpoint"})
+		return
+	}
+	csrfToken, err := oauth.NewLoginCSRFToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+		fmt.Printf("Couldn't create login csrf token: %s", err.Error())
+		return
+	}
+	setCookie(c, oauth.LoginCSRFCookie, csrfToken, "/oauth", time.Now().Add(time.Hour), oauth.SecureCookies())
+	renderLogin(c, http.StatusOK, oauth.LoginPage{ReturnTo: returnTo, CSRFToken: csrfToken})
+}
+
+// OAuthLogin checks the credentials posted by the login page, starts a browser session and sends the
+// browser back to the authorization request. It counts against the same limits as Login.
+func OAuthLogin(c *gin.Context) {
+
+	returnTo := c.PostForm("return_to")
+	if !oauth.ValidReturnTo(returnTo) {
+		c.JSON(http.StatusBadRequest, &oauth.Error{Code: "invalid_request", Description: "return_to must be the authorization endpoint"})
+		return
+	}
+	csrfToken, err := c.Cookie(oauth.LoginCSRFCookie)
+	if err != nil || len(csrfToken) == 0 || subtle.ConstantTimeCompare([]byte(csrfToken), []byte(c.PostForm("csrf_token"))) != 1 {
+		c.Redirect(http.StatusFound, oauth.LoginURL(returnTo))
+		return
+	}
+	identifier := strings.TrimSpace(c.PostForm("username"))
+	page := oauth.LoginPage{ReturnTo: returnTo, CSRFToken: csrfToken, Username: identifier}
+	invalid := func() {
+		page.Error = "Invalid credentials"
+		renderLogin(c, http.StatusUnauthorized, page)
+	}
+	if len(identifier) == 0 {
+		invalid()
+		return
+	}
+
+	var user models.User
+	result := initializers.DB.Limit(1).Find(&user, "username = ? OR email = ?", identifier, identifier)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+		fmt.Printf("Couldn't fetch user: %s", result.Error.Error())
+		return
+	}
+	found := result.RowsAffected > 0
+	account := lockout.Subject(identifier)
+	if found {
+		account = lockout.Subject(user.Username)
+	}
+	ip := c.ClientIP()
+	wait, err := lockout.Attempt(account, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+		fmt.Printf("Couldn't check login throttle: %s", err.Error())
+		return
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		page.Error = "Too many failed logins, try again later"
+		renderLogin(c, http.StatusTooManyRequests, page)
+		return
+	}
+	recordFailure := func() {
+		if err := lockout.RecordFailure(account, ip); err != nil {
+			fmt.Printf("Couldn't record failed login: %s", err.Error())
+		}
+	}
+
+	passwordHash := dummyPasswordHash
+	if found {
+		passwordHash = []byte(user.Password)
+	}
+	if err := bcrypt.CompareHashAndPassword(passwordHash, []byte(c.PostForm("password"))); err != nil || !found ||
+		!user.IsActive || user.IsServiceAccount {
+		recordFailure()
+		invalid()
+		return
+	}
+	required, err := twofactor.Required(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+		fmt.Printf("Couldn't check two-factor requirement: %s", err.Error())
+		return
+	}
+	enabled, err := twofactor.Enabled(user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+		fmt.Printf("Couldn't check two-factor enrollment: %s", err.Error())
+		return
+	}
+	if required && !enabled {
+		page.Error = "Set up two-factor authentication before signing in here"
+		renderLogin(c, http.StatusForbidden, page)
+		return
+	}
+	if enabled {
+		if err := twofactor.Verify(user.Username, c.PostForm("code"), ""); err != nil {
+			if !errors.Is(err, twofactor.ErrInvalidCode) {
+				c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+				fmt.Printf("Couldn't verify code: %s", err.Error())
+				return
+			}
+			recordFailure()
+			page.Error = "Invalid credentials or two-factor code"
+			renderLogin(c, http.StatusUnauthorized, page)
+			return
+		}
+	}
+
+	session, expiresAt, err := oauth.StartBrowserSession(user, ip, c.Request.UserAgent())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+		fmt.Printf("Couldn't start browser session: %s", err.Error())
+		return
+	}
+	if err := lockout.RecordSuccess(account, ip); err != nil {
+		fmt.Printf("Couldn't reset login throttle: %s", err.Error())
+	}
+	setCookie(c, oauth.SessionCookie, session, "/oauth", expiresAt, oauth.SecureCookies())
+	setCookie(c, oauth.LoginCSRFCookie, "", "/oauth", time.Unix(0, 0), oauth.SecureCookies())
+	c.Redirect(http.StatusFound, returnTo)
+}
+
+func renderLogin(c *gin.Context, status int, page oauth.LoginPage) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := oauth.RenderLogin(c.Writer, page); err != nil {
+		fmt.Printf("Couldn't render login page: %s", err.Error())
+	}
+}
+
+// setCookie sets a cookie scripts can't read and only the endpoints under path see. Lax keeps it on the
+// top-level redirects between sites sign-ins are made of, but off requests other sites make in the background.
+func setCookie(c *gin.Context, name string, value string, path string, expiresAt time.Time, secure bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Expires:  expiresAt,
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Token is the token endpoint. Clients authenticate with HTTP Basic or form parameters; public clients
+// only send their client_id and rely on PKCE.
+func Token(c *gin.Context) {
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	clientID, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// RFC 6749 form-encodes credentials before putting them in the header.
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = c.PostForm("client_id")
+		secret = c.PostForm("client_secret")
+	}
+	client, err := oauth.FindClient(clientID)
+	if err == nil {
+		err = client.Authenticate(secret)
+	}
+	if errors.Is(err, oauth.ErrInvalidClient) {
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		c.JSON(http.StatusUnauthorized, &oauth.Error{Code: "invalid_client", Description: "Client authentication failed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+		fmt.Printf("Couldn't fetch oauth client: %s", err.Error())
+		return
+	}
+
+	if c.PostForm("grant_type") != "authorization_code" {
+		c.JSON(http.StatusBadRequest, &oauth.Error{Code: "unsupported_grant_type", Description: "Only the authorization_code grant is supported"})
+		return
+	}
+	code := c.PostForm("code")
+	codeVerifier := c.PostForm("code_verifier")
+	if len(code) == 0 || len(codeVerifier) == 0 {
+		c.JSON(http.StatusBadRequest, &oauth.Error{Code: "invalid_request", Description: "code and code_verifier are required"})
+		return
+	}
+	response, err := oauth.ExchangeCode(client, code, c.PostForm("redirect_uri"), codeVerifier, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		var oauthErr *oauth.Error
+		if errors.As(err, &oauthErr) {
+			c.JSON(http.StatusBadRequest, oauthErr)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+		fmt.Printf("Couldn't exchange authorization code: %s", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UserInfo returns the claims about the user the access token of a client was issued for.
+func UserInfo(c *gin.Context) {
+
+	tokenString := c.Request.Header.Get("Authorization")
+	prefix := "Bearer"
+	if strings.HasPrefix(tokenString, prefix) {
+		tokenString = strings.TrimSpace(tokenString[len(prefix):])
+	}
+	if len(tokenString) == 0 {
+		c.Header("WWW-Authenticate", `Bearer`)
+		c.JSON(http.StatusUnauthorized, &oauth.Error{Code: "invalid_request", Description: "Authorization token not found"})
+		return
+	}
+	user, scope, err := oauth.VerifyAccessToken(tokenString)
+	if err != nil {
+		if !tokens.Rejected(err) {
+			c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+			fmt.Printf("Couldn't check token: %s", err.Error())
+			return
+		}
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.JSON(http.StatusUnauthorized, &oauth.Error{Code: "invalid_token", Description: tokens.Message(err)})
+		return
+	}
+	if !strings.Contains(" "+scope+" ", " "+oauth.ScopeOpenID+" ") {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		c.JSON(http.StatusForbidden, &oauth.Error{Code: "insufficient_scope", Description: "The openid scope is required"})
+		return
+	}
+	claims, err := oauth.UserClaims(user, scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, &oauth.Error{Code: "server_error"})
+		fmt.Printf("Couldn't resolve claims for %s: %s", user.Username, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, claims)
+}
+
+func CreateOAuthClient(c *gin.Context) {
+
+	var body struct {
+		Name         string   `json:"name" validate:"required"`
+		RedirectURIs []string `json:"redirect_uris" validate:"required,min=1"`
+		Confidential bool     `json:"confidential"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+	for _, uri := range body.RedirectURIs {
+		if !oauth.ValidRedirectURI(uri) {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse(fmt.Sprintf("Invalid redirect uri %s", uri)))
+			return
+		}
+	}
+
+	client, secret, err := oauth.RegisterClient(body.Name, body.RedirectURIs, body.Confidential, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't register oauth client: %s", err.Error())
+		return
+	}
+	data := struct {
+		Client       oauth.Client `json:"client"`
+		ClientSecret string       `json:"client_secret,omitempty"`
+	}{
+		Client:       client,
+		ClientSecret: secret,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func GetOAuthClients(c *gin.Context) {
+
+	clients, err := oauth.Clients()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch oauth clients: %s", err.Error())
+		return
+	}
+	data := struct {
+		Clients []oauth.Client `json:"clients"`
+	}{
+		Clients: clients,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func DeleteOAuthClient(c *gin.Context) {
+
+	clientID := c.Param("client_id")
+	if len(strings.TrimSpace(clientID)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Client ID is required"))
+		return
+	}
+	deleted, err := oauth.DeleteClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't delete oauth client: %s", err.Error())
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse(fmt.Sprintf("Couldn't find client with id %s", clientID)))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/mailer"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/guptaharsh13/balkanid-task/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ForgotPassword answers the same way whether or not the email belongs to an account.
+func ForgotPassword(c *gin.Context) {
+
+	var body struct {
+		Email string `json:"email" validate:"email,required"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+
+	var user models.User
+	if result := initializers.DB.Limit(1).Find(&user, "email = ? AND is_active = ? AND is_service_account = ?", body.Email, true, false); result.Error != nil {
+		fmt.Printf("Couldn't fetch user: %s", result.Error.Error())
+	} else if result.RowsAffected > 0 {
+		token, err := tokens.IssueResetToken(user)
+		if err != nil {
+			fmt.Printf("Couldn't create reset token: %s", err.Error())
+		} else {
+			deliverPasswordReset(user, token)
+		}
+	}
+
+	data := struct {
+		Message string `json:"message"`
+	}{
+		Message: "If an account with that email exists, a password reset link has been sent",
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// deliverPasswordReset emails the user a link to the reset page carrying the token.
+func deliverPasswordReset(user models.User, token string) {
+
+	link, err := url.Parse(mailer.ResetURL())
+	if err != nil {
+		fmt.Printf("Couldn't parse password reset url: %s", err.Error())
+		return
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	data := mailer.LinkData{Username: user.Username, Link: link.String(), ExpiresIn: mailer.FormatDuration(tokens.ResetTokenTTL())}
+	if err := mailer.Enqueue(user.Email, mailer.TemplatePasswordReset, data); err != nil {
+		fmt.Printf("Couldn't queue password reset email: %s", err.Error())
+	}
+}
+
+func ResetPassword(c *gin.Context) {
+
+	var body struct {
+		Token       string `json:"token" validate:"required"`
+		NewPassword string `json:"new_password" validate:"password,required"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), 10)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't hash password: %s", err.Error())
+		return
+	}
+	user, err := tokens.RedeemResetToken(body.Token)
+	if err != nil {
+		if errors.Is(err, tokens.ErrInvalidResetToken) {
+			c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Invalid or expired reset token"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't redeem reset token: %s", err.Error())
+		return
+	}
+	if result := initializers.DB.Model(&user).Update("password", string(hash)); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't update user: %s", result.Error.Error())
+		return
+	}
+	if err := tokens.RevokeUser(user.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't revoke tokens: %s", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
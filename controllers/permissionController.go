@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/utils"
+	"gorm.io/gorm"
+)
+
+func CreatePermission(c *gin.Context) {
+
+	var body struct {
+		Table       string `json:"table" validate:"required,identifier"`
+		Operation   string `json:"operation" validate:"required,identifier"`
+		Description string `json:"description"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+
+	permission := models.Permission{
+		Table:       strings.ToLower(body.Table),
+		Operation:   strings.ToUpper(body.Operation),
+		Description: body.Description,
+	}
+	permission.Name = authz.PermissionName(permission.Table, permission.Operation)
+	if result := initializers.DB.Take(&models.Permission{}, "name = ?", permission.Name); result.RowsAffected > 0 {
+		c.JSON(http.StatusConflict, utils.ConflictResponse("Permission already exists"))
+		return
+	}
+	if result := initializers.DB.Create(&permission); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	data := struct {
+		Permission models.Permission `json:"permission"`
+	}{
+		Permission: permission,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func GetPermissions(c *gin.Context) {
+
+	query := initializers.DB.Order("name")
+	if table := c.Query("table"); len(table) > 0 {
+		query = query.Where("\"table\" = ?", table)
+	}
+	if builtIn := c.Query("built_in"); len(builtIn) > 0 {
+		query = query.Where("is_built_in = ?", builtIn == "true")
+	}
+	var permissions []models.Permission
+	if result := query.Find(&permissions); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	data := struct {
+		Permissions []models.Permission `json:"permissions"`
+	}{
+		Permissions: permissions,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func GetPermissionByName(c *gin.Context) {
+
+	name := c.Param("name")
+	if len(strings.TrimSpace(name)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Name is required"))
+		return
+	}
+	var permission models.Permission
+	if result := initializers.DB.Preload("Roles").Preload("Groups").Take(&permission, "name = ?", name); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find permission"))
+		return
+	}
+	data := struct {
+		Permission models.Permission `json:"permission"`
+	}{
+		Permission: permission,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func UpdatePermissionPut(c *gin.Context) {
+
+	name := c.Param("name")
+	if len(strings.TrimSpace(name)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Name is required"))
+		return
+	}
+	var permission models.Permission
+	if result := initializers.DB.Take(&permission, "name = ?", name); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find permission"))
+		return
+	}
+
+	var body struct {
+		Table       string `json:"table" validate:"required,identifier"`
+		Operation   string `json:"operation" validate:"required,identifier"`
+		Description string `json:"description"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+
+	permission.Description = body.Description
+	if status, message := renamePermission(&permission, body.Table, body.Operation); status != http.StatusOK {
+		c.JSON(int(status), utils.ErrorResponse(status, message))
+		return
+	}
+	if err := savePermission(&permission, name); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	data := struct {
+		Permission models.Permission `json:"permission"`
+	}{
+		Permission: permission,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func UpdatePermissionPatch(c *gin.Context) {
+
+	name := c.Param("name")
+	if len(strings.TrimSpace(name)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Name is required"))
+		return
+	}
+	var permission models.Permission
+	if result := initializers.DB.Take(&permission, "name = ?", name); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find permission"))
+		return
+	}
+
+	requestBytes, err := io.ReadAll(c.Request.Body)
+	defer c.Request.Body.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	var body struct {
+		Table       *string `json:"table"`
+		Operation   *string `json:"operation"`
+		Description *string `json:"description"`
+	}
+	if err = json.Unmarshal(requestBytes, &body); err != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+
+	if body.Description != nil {
+		permission.Description = *body.Description
+	}
+	table := permission.Table
+	if body.Table != nil {
+		table = *body.Table
+	}
+	operation := permission.Operation
+	if body.Operation != nil {
+		operation = *body.Operation
+	}
+	if status, message := renamePermission(&permission, table, operation); status != http.StatusOK {
+		c.JSON(int(status), utils.ErrorResponse(status, message))
+		return
+	}
+	if err := savePermission(&permission, name); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	data := struct {
+		Permission models.Permission `json:"permission"`
+	}{
+		Permission: permission,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func DeletePermission(c *gin.Context) {
+
+	name := c.Param("name")
+	if len(strings.TrimSpace(name)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Name is required"))
+		return
+	}
+	var permission models.Permission
+	if result := initializers.DB.Take(&permission, "name = ?", name); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find permission"))
+		return
+	}
+	if permission.IsBuiltIn {
+		c.JSON(http.StatusForbidden, utils.ForbiddenResponse("Built-in permissions can't be deleted"))
+		return
+	}
+	if result := initializers.DB.Unscoped().Select("Roles", "Groups").Delete(&permission); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
+
+// renamePermission moves a custom permission to a new table/operation pair. Built-in permissions keep theirs.
+func renamePermission(permission *models.Permission, table string, operation string) (uint, string) {
+
+	if !utils.IsValidIdentifier(table) || !utils.IsValidIdentifier(operation) {
+		return http.StatusBadRequest, "Table and operation must start with a letter and contain only letters, numbers and underscores"
+	}
+	table = strings.ToLower(table)
+	operation = strings.ToUpper(operation)
+	if table == permission.Table && operation == permission.Operation {
+		return http.StatusOK, ""
+	}
+	if permission.IsBuiltIn {
+		return http.StatusForbidden, "Built-in permissions can't change their table or operation"
+	}
+	name := authz.PermissionName(table, operation)
+	if result := initializers.DB.Take(&models.Permission{}, "name = ?", name); result.RowsAffected > 0 {
+		return http.StatusConflict, "Permission already exists"
+	}
+	permission.Table = table
+	permission.Operation = operation
+	permission.Name = name
+	return http.StatusOK, ""
+}
+
+// savePermission saves the permission and carries a rename over to the role and group grants referencing it.
+func savePermission(permission *models.Permission, oldName string) error {
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"name":        permission.Name,
+			"table":       permission.Table,
+			"operation":   permission.Operation,
+			"description": permission.Description,
+		}
+		if result := tx.Model(&models.Permission{}).Where("id = ?", permission.ID).Updates(updates); result.Error != nil {
+			return result.Error
+		}
+		if permission.Name == oldName {
+			return nil
+		}
+		if result := tx.Model(&models.RolePermission{}).Where("permission_id = ?", permission.ID).Update("permission_name", permission.Name); result.Error != nil {
+			return result.Error
+		}
+		return tx.Model(&models.GroupPermission{}).Where("permission_id = ?", permission.ID).Update("permission_name", permission.Name).Error
+	})
+}
@@ -2,23 +2,29 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
 	"github.com/guptaharsh13/balkanid-task/initializers"
 	"github.com/guptaharsh13/balkanid-task/models"
 	"github.com/guptaharsh13/balkanid-task/utils"
+	"gorm.io/gorm/clause"
 )
 
 func CreateRole(c *gin.Context) {
 
 	var body struct {
-		Name        string   `json:"name" validate:"required"`
-		Description string   `json:"description"`
-		Users       []string `json:"users"`
-		Permissions []string `json:"permissions"`
+		Name             string   `json:"name" validate:"required"`
+		Description      string   `json:"description"`
+		RequireTwoFactor bool     `json:"require_two_factor"`
+		Users            []string `json:"users"`
+		Permissions      []string `json:"permissions"`
+		Parents          []string `json:"parents"`
 	}
 	if c.Bind(&body) != nil {
 		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
@@ -57,12 +63,34 @@ func CreateRole(c *gin.Context) {
 		return
 	}
 
+	var parents []models.Role
+	result = initializers.DB.Where("name IN ?", body.Parents).Find(&parents)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	if result.RowsAffected != int64(len(body.Parents)) {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Parent roles not found"))
+		return
+	}
+
 	role := models.Role{
-		Name:        body.Name,
-		Description: body.Description,
-		Users:       users,
-		Permissions: permissions,
+		Name:             body.Name,
+		Description:      body.Description,
+		RequireTwoFactor: body.RequireTwoFactor,
+		Users:            users,
+		Permissions:      permissions,
 	}
+	cycle, err := authz.CreatesRoleCycle(role, parents)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	if cycle {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Role inheritance cycle"))
+		return
+	}
+	role.Parents = parents
 	if result := initializers.DB.Create(&role); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
 		return
@@ -78,7 +106,7 @@ func CreateRole(c *gin.Context) {
 func GetRoles(c *gin.Context) {
 
 	var roles []models.Role
-	if result := initializers.DB.Preload("Users").Preload("Permissions").Find(&roles); result.Error != nil {
+	if result := initializers.DB.Preload("Users").Preload("Permissions").Preload("Parents").Find(&roles); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
 		return
 	}
@@ -98,14 +126,33 @@ func GetRoleByName(c *gin.Context) {
 		return
 	}
 	var role models.Role
-	if result := initializers.DB.Preload("Users").Preload("Permissions").Take(&role, "name = ?", name); result.Error != nil {
+	if result := initializers.DB.Preload("Users").Preload("Permissions").Preload("Parents").Take(&role, "name = ?", name); result.Error != nil {
 		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find role"))
 		return
 	}
+	chain, err := authz.RoleChain(role.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	inherited := []authz.Grant{}
+	for _, link := range chain[1:] {
+		for _, entry := range link.Permissions {
+			inherited = append(inherited, authz.Grant{
+				Permission: entry.Permission,
+				Effect:     entry.Effect,
+				Sources:    []authz.Source{{Type: authz.SourceRole, Name: link.Role.Name, Via: link.Via, Effect: entry.Effect}},
+			})
+		}
+	}
 	data := struct {
-		Role models.Role `json:"role"`
+		Role                 models.Role               `json:"role"`
+		DirectPermissions    []authz.GrantedPermission `json:"direct_permissions"`
+		InheritedPermissions []authz.Grant             `json:"inherited_permissions"`
 	}{
-		Role: role,
+		Role:                 role,
+		DirectPermissions:    chain[0].Permissions,
+		InheritedPermissions: inherited,
 	}
 	c.JSON(http.StatusOK, utils.SuccessResponse(data))
 }
@@ -118,16 +165,18 @@ func UpdateRolePut(c *gin.Context) {
 		return
 	}
 	var role models.Role
-	if result := initializers.DB.Preload("Users").Preload("Permissions").Take(&role, "name = ?", name); result.Error != nil {
+	if result := initializers.DB.Preload("Users").Preload("Permissions").Preload("Parents").Take(&role, "name = ?", name); result.Error != nil {
 		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find role"))
 		return
 	}
 
 	var body struct {
-		Name        string   `json:"name"`
-		Description string   `json:"description"`
-		Users       []string `json:"users"`
-		Permissions []string `json:"permissions"`
+		Name             string   `json:"name"`
+		Description      string   `json:"description"`
+		RequireTwoFactor bool     `json:"require_two_factor"`
+		Users            []string `json:"users"`
+		Permissions      []string `json:"permissions"`
+		Parents          []string `json:"parents"`
 	}
 	if c.Bind(&body) != nil {
 		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
@@ -168,12 +217,38 @@ func UpdateRolePut(c *gin.Context) {
 		return
 	}
 
+	var parents []models.Role
+	result = initializers.DB.Where("name IN ?", body.Parents).Find(&parents)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	if result.RowsAffected != int64(len(body.Parents)) {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Parent roles not found"))
+		return
+	}
+	cycle, err := authz.CreatesRoleCycle(role, parents)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	if cycle {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Role inheritance cycle"))
+		return
+	}
+
 	if len(body.Name) > 0 {
 		role.Name = body.Name
 	}
 	role.Description = body.Description
+	role.RequireTwoFactor = body.RequireTwoFactor
 	role.Users = users
 	role.Permissions = permissions
+	if err := initializers.DB.Model(&role).Association("Parents").Replace(parents); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	role.Parents = parents
 	if result := initializers.DB.Save(&role); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
 		return
@@ -194,7 +269,7 @@ func UpdateRolePatch(c *gin.Context) {
 		return
 	}
 	var role models.Role
-	if result := initializers.DB.Preload("Users").Preload("Permissions").Take(&role, "name = ?", name); result.Error != nil {
+	if result := initializers.DB.Preload("Users").Preload("Permissions").Preload("Parents").Take(&role, "name = ?", name); result.Error != nil {
 		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find role"))
 		return
 	}
@@ -225,6 +300,15 @@ func UpdateRolePatch(c *gin.Context) {
 		role.Description = description.(string)
 	}
 
+	if value, ok := body["require_two_factor"]; ok {
+		requireTwoFactor, ok := value.(bool)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Require Two Factor must be a boolean"))
+			return
+		}
+		role.RequireTwoFactor = requireTwoFactor
+	}
+
 	if value, ok := body["users"]; ok {
 		usernames := value.([]string)
 		var users []models.User
@@ -255,6 +339,47 @@ func UpdateRolePatch(c *gin.Context) {
 		role.Permissions = permissions
 	}
 
+	if value, ok := body["parents"]; ok {
+		values, ok := value.([]interface{})
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Parents must be a list of role names"))
+			return
+		}
+		parentNames := []string{}
+		for _, value := range values {
+			parentName, ok := value.(string)
+			if !ok {
+				c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Parents must be a list of role names"))
+				return
+			}
+			parentNames = append(parentNames, parentName)
+		}
+		var parents []models.Role
+		result := initializers.DB.Where("name IN ?", parentNames).Find(&parents)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			return
+		}
+		if result.RowsAffected != int64(len(parentNames)) {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Parent roles not found"))
+			return
+		}
+		cycle, err := authz.CreatesRoleCycle(role, parents)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			return
+		}
+		if cycle {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Role inheritance cycle"))
+			return
+		}
+		if err := initializers.DB.Model(&role).Association("Parents").Replace(parents); err != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			return
+		}
+		role.Parents = parents
+	}
+
 	if result := initializers.DB.Save(&role); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
 		return
@@ -301,6 +426,8 @@ func AddPermissionsToRole(c *gin.Context) {
 
 	var body struct {
 		Permissions []string `json:"permissions"`
+		Effect      string   `json:"effect" validate:"omitempty,oneof=allow deny"`
+		Condition   string   `json:"condition"`
 	}
 	if c.Bind(&body) != nil {
 		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
@@ -322,15 +449,51 @@ func AddPermissionsToRole(c *gin.Context) {
 		return
 	}
 
-	role.Permissions = append(role.Permissions, permissions...)
-	if result := initializers.DB.Save(&role); result.Error != nil {
+	effect := body.Effect
+	if len(effect) == 0 {
+		effect = models.EffectAllow
+	}
+	if len(body.Condition) > 0 {
+		if _, err := authz.CompileCondition(body.Condition); err != nil {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse(fmt.Sprintf("Invalid condition: %s", err.Error())))
+			return
+		}
+	}
+	links := []models.RolePermission{}
+	for _, permission := range permissions {
+		links = append(links, models.RolePermission{
+			RoleID:         role.ID,
+			RoleName:       role.Name,
+			PermissionID:   permission.ID,
+			PermissionName: permission.Name,
+			Effect:         effect,
+			Condition:      body.Condition,
+		})
+	}
+	if len(links) > 0 {
+		if result := initializers.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "role_id"}, {Name: "role_name"}, {Name: "permission_id"}, {Name: "permission_name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"effect", "condition"}),
+		}).Create(&links); result.Error != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			return
+		}
+	}
+	if result := initializers.DB.Preload("Permissions").Take(&role, role.ID); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	granted, err := authz.RolePermissions(role.ID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
 		return
 	}
 	data := struct {
-		Role models.Role `json:"role"`
+		Role              models.Role               `json:"role"`
+		DirectPermissions []authz.GrantedPermission `json:"direct_permissions"`
 	}{
-		Role: role,
+		Role:              role,
+		DirectPermissions: granted,
 	}
 	c.JSON(http.StatusOK, utils.SuccessResponse(data))
 }
@@ -349,7 +512,9 @@ func AssignRoleToUser(c *gin.Context) {
 	}
 
 	var body struct {
-		Users []string `json:"users"`
+		Users      []string   `json:"users"`
+		ValidFrom  *time.Time `json:"valid_from"`
+		ValidUntil *time.Time `json:"valid_until"`
 	}
 	if c.Bind(&body) != nil {
 		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
@@ -360,6 +525,10 @@ func AssignRoleToUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
 		return
 	}
+	if body.ValidFrom != nil && body.ValidUntil != nil && !body.ValidUntil.After(*body.ValidFrom) {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("valid_until must be after valid_from"))
+		return
+	}
 	var users []models.User
 	result := initializers.DB.Where("username IN ?", body.Users).Find(&users)
 	if result.Error != nil {
@@ -371,19 +540,74 @@ func AssignRoleToUser(c *gin.Context) {
 		return
 	}
 
-	role.Users = append(role.Users, users...)
-	if result := initializers.DB.Save(&role); result.Error != nil {
+	memberships := []models.UserRole{}
+	for _, user := range users {
+		memberships = append(memberships, models.UserRole{
+			UserID:       user.ID,
+			UserUsername: user.Username,
+			RoleID:       role.ID,
+			RoleName:     role.Name,
+			ValidFrom:    body.ValidFrom,
+			ValidUntil:   body.ValidUntil,
+		})
+	}
+	if len(memberships) > 0 {
+		if result := initializers.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "user_username"}, {Name: "role_id"}, {Name: "role_name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"valid_from", "valid_until", "source"}),
+		}).Create(&memberships); result.Error != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			return
+		}
+	}
+	if result := initializers.DB.Preload("Users").Take(&role, role.ID); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
 		return
 	}
 	data := struct {
-		Role models.Role `json:"role"`
+		Role        models.Role       `json:"role"`
+		Memberships []models.UserRole `json:"memberships"`
 	}{
-		Role: role,
+		Role:        role,
+		Memberships: memberships,
 	}
 	c.JSON(http.StatusOK, utils.SuccessResponse(data))
 }
 
+func RemoveRoleFromUser(c *gin.Context) {
+
+	name := c.Param("name")
+	if len(strings.TrimSpace(name)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Role name is required"))
+		return
+	}
+	username := c.Param("username")
+	if len(strings.TrimSpace(username)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Username is required"))
+		return
+	}
+	var role models.Role
+	if result := initializers.DB.Take(&role, "name = ?", name); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find role"))
+		return
+	}
+	var user models.User
+	if result := initializers.DB.Take(&user, "username = ?", username); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("User not found"))
+		return
+	}
+	if count := initializers.DB.Model(&role).Where("username = ?", user.Username).Association("Users").Count(); count == 0 {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("User doesn't have this role"))
+		return
+	}
+
+	if err := initializers.DB.Model(&role).Association("Users").Delete(&user); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
+
 func GetUsersByRole(c *gin.Context) {
 	name := c.Param("name")
 	if len(strings.TrimSpace(name)) == 0 {
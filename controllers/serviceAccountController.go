@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// serviceAccountEmailDomain fills the required email of service accounts. The .invalid TLD never resolves.
+const serviceAccountEmailDomain = "service-accounts.invalid"
+
+func CreateServiceAccount(c *gin.Context) {
+
+	var body struct {
+		Username string `json:"username" validate:"username,required"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+	if result := initializers.DB.Take(&models.User{}, "username = ?", body.Username); result.RowsAffected > 0 {
+		c.JSON(http.StatusConflict, utils.ConflictResponse("Username already taken"))
+		return
+	}
+
+	// Nobody knows the password, and Login refuses service accounts anyway.
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(base64.RawURLEncoding.EncodeToString(secret)), 10)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't hash password: %s", err.Error())
+		return
+	}
+	user := models.User{
+		Username:         body.Username,
+		Email:            fmt.Sprintf("%s@%s", body.Username, serviceAccountEmailDomain),
+		Password:         string(hash),
+		IsActive:         true,
+		IsServiceAccount: true,
+	}
+	if result := initializers.DB.Create(&user); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't create service account: %s", result.Error.Error())
+		return
+	}
+	data := struct {
+		User models.User `json:"user"`
+	}{
+		User: user,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func GetServiceAccounts(c *gin.Context) {
+
+	var users []models.User
+	if result := initializers.DB.Find(&users, "is_service_account = ?", true); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch service accounts: %s", result.Error.Error())
+		return
+	}
+	data := struct {
+		Users []models.User `json:"users"`
+	}{
+		Users: users,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func takeServiceAccount(c *gin.Context) (models.User, bool) {
+
+	var user models.User
+	username := c.Param("username")
+	if len(strings.TrimSpace(username)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Username is required"))
+		return user, false
+	}
+	if result := initializers.DB.Take(&user, "username = ? AND is_service_account = ?", username, true); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Service account not found"))
+		return user, false
+	}
+	return user, true
+}
+
+func GetServiceAccountTokens(c *gin.Context) {
+
+	user, ok := takeServiceAccount(c)
+	if !ok {
+		return
+	}
+	getAPITokens(c, user.Username)
+}
+
+func CreateServiceAccountToken(c *gin.Context) {
+
+	user, ok := takeServiceAccount(c)
+	if !ok {
+		return
+	}
+	createAPIToken(c, user)
+}
+
+func RevokeServiceAccountToken(c *gin.Context) {
+
+	user, ok := takeServiceAccount(c)
+	if !ok {
+		return
+	}
+	revokeAPIToken(c, user.Username)
+}
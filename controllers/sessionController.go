@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/guptaharsh13/balkanid-task/utils"
+)
+
+// currentSession returns the session ID of the access token of the request, if any.
+func currentSession(c *gin.Context) string {
+	claims, ok := c.Get("claims")
+	if !ok {
+		return ""
+	}
+	sessionID, _ := claims.(jwt.MapClaims)["sid"].(string)
+	return sessionID
+}
+
+func GetSessions(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+	getSessions(c, username.(string))
+}
+
+func RevokeSession(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+	revokeSession(c, username.(string))
+}
+
+// RevokeOtherSessions ends every session of the caller except the current one.
+func RevokeOtherSessions(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+	revokeSessions(c, username.(string), currentSession(c))
+}
+
+func GetUserSessions(c *gin.Context) {
+
+	user, ok := takeUser(c)
+	if !ok {
+		return
+	}
+	getSessions(c, user.Username)
+}
+
+func RevokeUserSession(c *gin.Context) {
+
+	user, ok := takeUser(c)
+	if !ok {
+		return
+	}
+	revokeSession(c, user.Username)
+}
+
+func RevokeUserSessions(c *gin.Context) {
+
+	user, ok := takeUser(c)
+	if !ok {
+		return
+	}
+	revokeSessions(c, user.Username, "")
+}
+
+func takeUser(c *gin.Context) (models.User, bool) {
+
+	var user models.User
+	username := c.Param("username")
+	if len(strings.TrimSpace(username)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Username is required"))
+		return user, false
+	}
+	if result := initializers.DB.Take(&user, "username = ?", username); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("User not found"))
+		return user, false
+	}
+	return user, true
+}
+
+func getSessions(c *gin.Context, username string) {
+
+	sessions, err := tokens.Sessions(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch sessions: %s", err.Error())
+		return
+	}
+	type session struct {
+		models.Session
+		Current bool `json:"current"`
+	}
+	current := currentSession(c)
+	entries := make([]session, 0, len(sessions))
+	for _, entry := range sessions {
+		entries = append(entries, session{Session: entry, Current: entry.ID == current})
+	}
+	data := struct {
+		Sessions []session `json:"sessions"`
+	}{
+		Sessions: entries,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func revokeSession(c *gin.Context, username string) {
+
+	id := c.Param("id")
+	if len(strings.TrimSpace(id)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("ID is required"))
+		return
+	}
+	revoked, err := tokens.RevokeSession(username, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't revoke session: %s", err.Error())
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse(fmt.Sprintf("Couldn't find active session with id %s", id)))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
+
+func revokeSessions(c *gin.Context, username string, except string) {
+
+	revoked, err := tokens.RevokeSessions(username, except)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't revoke sessions: %s", err.Error())
+		return
+	}
+	data := struct {
+		Revoked int64 `json:"revoked"`
+	}{
+		Revoked: revoked,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/utils"
+)
+
+type proposedPermission struct {
+	Name      string `json:"name" validate:"required"`
+	Effect    string `json:"effect" validate:"omitempty,oneof=allow deny"`
+	Condition string `json:"condition"`
+}
+
+type simulationBody struct {
+	Permissions *[]proposedPermission `json:"permissions" validate:"omitempty,dive"`
+	Users       *[]string             `json:"users"`
+}
+
+func SimulateRoleChange(c *gin.Context) {
+
+	name := c.Param("name")
+	if len(strings.TrimSpace(name)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Role name is required"))
+		return
+	}
+	var role models.Role
+	if result := initializers.DB.Take(&role, "name = ?", name); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find role"))
+		return
+	}
+
+	scenario := authz.Scenario{Type: authz.SourceRole, Role: role}
+	if !bindScenario(c, &scenario) {
+		return
+	}
+	impacts, err := authz.Simulate(&scenario)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't simulate role change: %s", err.Error())
+		return
+	}
+	data := struct {
+		Role    string             `json:"role"`
+		Impacts []authz.UserImpact `json:"impacts"`
+	}{
+		Role:    role.Name,
+		Impacts: impacts,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func SimulateGroupChange(c *gin.Context) {
+
+	name := c.Param("name")
+	if len(strings.TrimSpace(name)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Group name is required"))
+		return
+	}
+	var group models.Group
+	if result := initializers.DB.Take(&group, "name = ?", name); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find group"))
+		return
+	}
+
+	scenario := authz.Scenario{Type: authz.SourceGroup, Group: group}
+	if !bindScenario(c, &scenario) {
+		return
+	}
+	impacts, err := authz.Simulate(&scenario)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't simulate group change: %s", err.Error())
+		return
+	}
+	data := struct {
+		Group   string             `json:"group"`
+		Impacts []authz.UserImpact `json:"impacts"`
+	}{
+		Group:   group.Name,
+		Impacts: impacts,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// bindScenario reads the proposed permissions and members into the scenario, writing the error response itself.
+func bindScenario(c *gin.Context, scenario *authz.Scenario) bool {
+
+	var body simulationBody
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return false
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return false
+	}
+	if body.Permissions == nil && body.Users == nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Propose permissions or users"))
+		return false
+	}
+
+	if body.Permissions != nil {
+		names := []string{}
+		for _, proposed := range *body.Permissions {
+			names = append(names, proposed.Name)
+		}
+		var permissions []models.Permission
+		result := initializers.DB.Where("name IN ?", names).Find(&permissions)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			return false
+		}
+		if result.RowsAffected != int64(len(names)) {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Permissions not found"))
+			return false
+		}
+		byName := map[string]models.Permission{}
+		for _, permission := range permissions {
+			byName[permission.Name] = permission
+		}
+
+		scenario.Permissions = []authz.GrantedPermission{}
+		for _, proposed := range *body.Permissions {
+			effect := proposed.Effect
+			if len(effect) == 0 {
+				effect = models.EffectAllow
+			}
+			if len(proposed.Condition) > 0 {
+				if _, err := authz.CompileCondition(proposed.Condition); err != nil {
+					c.JSON(http.StatusBadRequest, utils.BadRequestResponse(fmt.Sprintf("Invalid condition: %s", err.Error())))
+					return false
+				}
+			}
+			scenario.Permissions = append(scenario.Permissions, authz.GrantedPermission{
+				Permission: byName[proposed.Name],
+				Effect:     effect,
+				Condition:  proposed.Condition,
+			})
+		}
+	}
+
+	if body.Users != nil {
+		var users []models.User
+		result := initializers.DB.Where("username IN ?", *body.Users).Find(&users)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			return false
+		}
+		if result.RowsAffected != int64(len(*body.Users)) {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Couldn't find all users"))
+			return false
+		}
+		scenario.Members = map[string]bool{}
+		for _, user := range users {
+			scenario.Members[user.Username] = true
+		}
+	}
+	return true
+}
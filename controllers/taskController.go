@@ -2,15 +2,21 @@ package controllers
 
 import (
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
 	"github.com/guptaharsh13/balkanid-task/initializers"
 	"github.com/guptaharsh13/balkanid-task/models"
 	"github.com/guptaharsh13/balkanid-task/utils"
+	"github.com/guptaharsh13/balkanid-task/workflow"
+	"gorm.io/gorm"
 )
 
 func CreateTask(c *gin.Context) {
@@ -22,9 +28,12 @@ func CreateTask(c *gin.Context) {
 	}
 
 	var body struct {
-		Name        string   `json:"name" validate:"required"`
-		Description string   `json:"description"`
-		Asignees    []string `json:"asignees"`
+		Name        string     `json:"name" validate:"required"`
+		Description string     `json:"description"`
+		Priority    string     `json:"priority" validate:"omitempty,oneof=low medium high urgent"`
+		StartDate   *time.Time `json:"start_date"`
+		DueDate     *time.Time `json:"due_date"`
+		Asignees    []string   `json:"asignees"`
 	}
 	if c.Bind(&body) != nil {
 		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
@@ -35,6 +44,13 @@ func CreateTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
 		return
 	}
+	if body.StartDate != nil && body.DueDate != nil && body.StartDate.After(*body.DueDate) {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Start date must not be after the due date"))
+		return
+	}
+	if len(body.Priority) == 0 {
+		body.Priority = models.PriorityMedium
+	}
 
 	var creator models.User
 	if result := initializers.DB.Take(&creator, "username = ?", username); result.Error != nil {
@@ -53,13 +69,31 @@ func CreateTask(c *gin.Context) {
 		return
 	}
 
+	initial, err := workflow.InitialState()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch initial task state: %s", err.Error())
+		return
+	}
 	task := models.Task{
 		Name:        body.Name,
 		Description: body.Description,
 		Creator:     creator.Username,
+		Status:      initial.Name,
+		Priority:    body.Priority,
+		StartDate:   body.StartDate,
+		DueDate:     body.DueDate,
 		Asignees:    asignees,
 	}
-	if result := initializers.DB.Create(&task); result.Error != nil {
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&task).Error; err != nil {
+			return err
+		}
+		activities := append([]models.TaskActivity{{TaskID: task.ID, Actor: creator.Username, Kind: models.ActivityCreated}},
+			assignmentActivities(task.ID, creator.Username, nil, asignees)...)
+		return tx.Create(&activities).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Internal Server Error",
 		})
@@ -71,32 +105,165 @@ func CreateTask(c *gin.Context) {
 	})
 }
 
+// filterTasks narrows query down by the filters in the query string. Status and priority take comma separated
+// lists, dates are RFC 3339, overdue=true keeps unfinished tasks past due and q searches names and descriptions.
+func filterTasks(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+
+	if creator := c.Query("creator"); len(creator) > 0 {
+		query = query.Where("tasks.creator = ?", creator)
+	}
+	if asignee := c.Query("asignee"); len(asignee) > 0 {
+		query = query.Where("tasks.id IN (?)", initializers.DB.Table("task_asignees").Select("task_id").Where("user_username = ?", asignee))
+	}
+	if search := strings.TrimSpace(c.Query("q")); len(search) > 0 {
+		pattern := "%" + strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(search) + "%"
+		query = query.Where("tasks.name ILIKE ? OR tasks.description ILIKE ?", pattern, pattern)
+	}
+
+	if status := c.Query("status"); len(status) > 0 {
+		query = query.Where("tasks.status IN ?", strings.Split(status, ","))
+	}
+	if priority := c.Query("priority"); len(priority) > 0 {
+		query = query.Where("tasks.priority IN ?", strings.Split(priority, ","))
+	}
+	for _, filter := range []struct {
+		param     string
+		condition string
+	}{
+		{"due_before", "tasks.due_date < ?"},
+		{"due_after", "tasks.due_date > ?"},
+		{"start_before", "tasks.start_date < ?"},
+		{"start_after", "tasks.start_date > ?"},
+	} {
+		value := c.Query(filter.param)
+		if len(value) == 0 {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse(fmt.Sprintf("%s must be an RFC 3339 date", filter.param)))
+			return nil, false
+		}
+		query = query.Where(filter.condition, date)
+	}
+	if c.Query("overdue") == "true" {
+		query = query.Where("tasks.due_date < ?", time.Now()).
+			Where("tasks.status NOT IN (?)", initializers.DB.Model(&models.TaskState{}).Select("name").Where("is_final = ?", true))
+	}
+	return query, true
+}
+
+// taskListing reports how far the caller may read tasks: all of them for admins and anyone granted read_tasks
+// unconditionally, and else those of authz.VisibleTasks. When conditions of a read_tasks grant decide, checked
+// is set and every task has to pass authz.ReadableTasks on its own.
+func taskListing(c *gin.Context) (all bool, checked bool, err error) {
+
+	resolution, err := authz.Resolve(c.GetString("username"))
+	if err != nil {
+		return false, false, err
+	}
+	if resolution.Decide("tasks", "READ", nil).Allowed {
+		return true, false, nil
+	}
+	_, granted := resolution.Grant("tasks", "READ")
+	return false, granted, nil
+}
+
+// GetTasks lists the tasks the caller may see, a page at a time. See filterTasks for the filters it takes.
 func GetTasks(c *gin.Context) {
 
-	var tasks []models.Task
-	if result := initializers.DB.Find(&tasks); result.Error != nil {
+	pagination, err := utils.ParsePagination(c.Query("page"), c.Query("per_page"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse(err.Error()))
+		return
+	}
+	query, ok := filterTasks(c, initializers.DB.Model(&models.Task{}))
+	if !ok {
+		return
+	}
+	all, checked, err := taskListing(c)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't resolve permissions for %s: %s", c.GetString("username"), err.Error())
 		return
 	}
+	if !all && !checked {
+		query = query.Scopes(authz.VisibleTasks(c.GetString("username"), time.Now()))
+	}
+	query = query.Session(&gorm.Session{})
+
+	var tasks []models.Task
+	if checked {
+		// Conditions are evaluated here rather than in the database, so the page is cut out of every readable task.
+		if result := query.Preload("Asignees").Order("tasks.id").Find(&tasks); result.Error != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			fmt.Printf("Couldn't fetch tasks: %s", result.Error.Error())
+			return
+		}
+		tasks, err = authz.ReadableTasks(c.GetString("username"), tasks)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			fmt.Printf("Couldn't check tasks for %s: %s", c.GetString("username"), err.Error())
+			return
+		}
+		pagination.Total = int64(len(tasks))
+		start, end := pagination.Offset(), pagination.Offset()+pagination.PerPage
+		if start > len(tasks) {
+			start = len(tasks)
+		}
+		if end > len(tasks) {
+			end = len(tasks)
+		}
+		tasks = tasks[start:end]
+	} else {
+		if result := query.Count(&pagination.Total); result.Error != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			fmt.Printf("Couldn't count tasks: %s", result.Error.Error())
+			return
+		}
+		result := query.Preload("Asignees").Order("tasks.id").Offset(pagination.Offset()).Limit(pagination.PerPage).Find(&tasks)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			fmt.Printf("Couldn't fetch tasks: %s", result.Error.Error())
+			return
+		}
+	}
 
 	data := struct {
-		Tasks []models.Task `json:"tasks"`
+		Tasks      []models.Task    `json:"tasks"`
+		Pagination utils.Pagination `json:"pagination"`
 	}{
-		Tasks: tasks,
+		Tasks:      tasks,
+		Pagination: pagination,
 	}
 	c.JSON(http.StatusOK, utils.SuccessResponse(data))
 }
 
+// authorizeTaskRead lets through whoever authz.CanReadTask allows to read task.
+func authorizeTaskRead(c *gin.Context, task models.Task) bool {
+
+	if c.GetBool("is_admin") {
+		return true
+	}
+	decision, err := authz.CanReadTask(c.GetString("username"), task)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return false
+	}
+	if !decision.Allowed {
+		c.JSON(http.StatusForbidden, utils.ForbiddenResponse(decision.Reason))
+		return false
+	}
+	return true
+}
+
 func GetTaskByID(c *gin.Context) {
 
-	id := c.Param("id")
-	if len(strings.TrimSpace(id)) == 0 {
-		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("ID is required"))
+	task, ok := takeTask(c)
+	if !ok {
 		return
 	}
-	var task models.Task
-	if result := initializers.DB.Preload("Asignees").Take(&task, "id = ?", id); result.Error != nil {
-		c.JSON(http.StatusNotFound, utils.NotFoundResponse(fmt.Sprintf("Couldn't find task with id %s", id)))
+	if !authorizeTaskRead(c, task) {
 		return
 	}
 	data := struct {
@@ -115,7 +282,7 @@ func DeleteTask(c *gin.Context) {
 		return
 	}
 	var task models.Task
-	if result := initializers.DB.Take(&task, "id = ?", id); result.Error != nil {
+	if result := initializers.DB.Preload("Asignees").Take(&task, "id = ?", id); result.Error != nil {
 		c.JSON(http.StatusNotFound, utils.NotFoundResponse(fmt.Sprintf("Couldn't find task with id %s", id)))
 		return
 	}
@@ -124,12 +291,13 @@ func DeleteTask(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
 		return
 	}
-	isAdmin, ok := c.Get("is_admin")
-	if !ok {
-		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+	decision, err := authz.DecideTask(username.(string), "DELETE", task, authz.RelationCreator)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
 	}
-	if username != task.Creator && !isAdmin.(bool) {
-		c.JSON(http.StatusForbidden, utils.ForbiddenResponse("Forbidden"))
+	if !decision.Allowed {
+		c.JSON(http.StatusForbidden, utils.ForbiddenResponse(decision.Reason))
 		return
 	}
 
@@ -159,6 +327,13 @@ func BulkUploadTasks(c *gin.Context) {
 	}
 	defer file.Close()
 
+	initial, err := workflow.InitialState()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch initial task state: %s", err.Error())
+		return
+	}
+
 	reader := csv.NewReader(file)
 	if _, err := reader.Read(); err != nil && err != io.EOF {
 		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Couldn't read CSV file (should have Name,Description as headers)"))
@@ -187,9 +362,20 @@ func BulkUploadTasks(c *gin.Context) {
 			Name:        name,
 			Description: description,
 			Creator:     user.Username,
+			Status:      initial.Name,
 		})
 	}
-	if result := initializers.DB.Create(&tasks); result.Error != nil {
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&tasks).Error; err != nil {
+			return err
+		}
+		activities := []models.TaskActivity{}
+		for _, task := range tasks {
+			activities = append(activities, models.TaskActivity{TaskID: task.ID, Actor: user.Username, Kind: models.ActivityCreated})
+		}
+		return tx.Create(&activities).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
 		fmt.Printf("Couldn't create tasks: %s", err.Error())
 		return
@@ -202,6 +388,28 @@ func BulkUploadTasks(c *gin.Context) {
 	c.JSON(http.StatusOK, utils.SuccessResponse(data))
 }
 
+// assignmentActivities records who of after wasn't assigned before, and who of before no longer is.
+func assignmentActivities(taskID uint, actor string, before []models.User, after []models.User) []models.TaskActivity {
+
+	assigned := map[string]bool{}
+	for _, user := range before {
+		assigned[user.Username] = true
+	}
+	activities := []models.TaskActivity{}
+	for _, user := range after {
+		if !assigned[user.Username] {
+			activities = append(activities, models.TaskActivity{TaskID: taskID, Actor: actor, Kind: models.ActivityAssigned, Subject: user.Username})
+		}
+		delete(assigned, user.Username)
+	}
+	for _, user := range before {
+		if assigned[user.Username] {
+			activities = append(activities, models.TaskActivity{TaskID: taskID, Actor: actor, Kind: models.ActivityUnassigned, Subject: user.Username})
+		}
+	}
+	return activities
+}
+
 func AssignTaskToUsers(c *gin.Context) {
 
 	id := c.Param("id")
@@ -210,7 +418,7 @@ func AssignTaskToUsers(c *gin.Context) {
 		return
 	}
 	var task models.Task
-	if result := initializers.DB.Take(&task, "id = ?", id); result.Error != nil {
+	if result := initializers.DB.Preload("Asignees").Take(&task, "id = ?", id); result.Error != nil {
 		c.JSON(http.StatusNotFound, utils.NotFoundResponse(fmt.Sprintf("Couldn't find task with id %s", id)))
 		return
 	}
@@ -219,12 +427,13 @@ func AssignTaskToUsers(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
 		return
 	}
-	isAdmin, ok := c.Get("is_admin")
-	if !ok {
-		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+	decision, err := authz.DecideTask(username.(string), "UPDATE", task, authz.RelationCreator)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
 	}
-	if username != task.Creator && !isAdmin.(bool) {
-		c.JSON(http.StatusForbidden, utils.ForbiddenResponse("Forbidden"))
+	if !decision.Allowed {
+		c.JSON(http.StatusForbidden, utils.ForbiddenResponse(decision.Reason))
 		return
 	}
 
@@ -235,7 +444,7 @@ func AssignTaskToUsers(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
 		return
 	}
-	err := utils.ValidateStruct(body)
+	err = utils.ValidateStruct(body)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
 		return
@@ -251,9 +460,89 @@ func AssignTaskToUsers(c *gin.Context) {
 		return
 	}
 
+	activities := assignmentActivities(task.ID, username.(string), task.Asignees, asignees)
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&task).Association("Asignees").Replace(asignees); err != nil {
+			return err
+		}
+		if len(activities) == 0 {
+			return nil
+		}
+		return tx.Create(&activities).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't assign task: %s", err.Error())
+		return
+	}
 	task.Asignees = asignees
-	if result := initializers.DB.Save(&task); result.Error != nil {
+	data := struct {
+		Task models.Task `json:"task"`
+	}{
+		Task: task,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// authorizeTaskUpdate lets the creator of task and admins through, and anyone else allowed to update it,
+// unless a deny applies.
+func authorizeTaskUpdate(c *gin.Context, task models.Task) bool {
+
+	decision, err := authz.DecideTask(c.GetString("username"), "UPDATE", task, authz.RelationCreator)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return false
+	}
+	if !decision.Allowed {
+		c.JSON(http.StatusForbidden, utils.ForbiddenResponse(decision.Reason))
+		return false
+	}
+	return true
+}
+
+func sameDate(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// saveTaskDetails writes the editable fields of task, leaving its status and asignees alone, and records
+// which of them changed since original in the feed of the task.
+func saveTaskDetails(c *gin.Context, original models.Task, task models.Task) {
+
+	if task.StartDate != nil && task.DueDate != nil && task.StartDate.After(*task.DueDate) {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Start date must not be after the due date"))
+		return
+	}
+	changed := []string{}
+	for _, field := range []struct {
+		name string
+		same bool
+	}{
+		{"name", original.Name == task.Name},
+		{"description", original.Description == task.Description},
+		{"priority", original.Priority == task.Priority},
+		{"start_date", sameDate(original.StartDate, task.StartDate)},
+		{"due_date", sameDate(original.DueDate, task.DueDate)},
+	} {
+		if !field.same {
+			changed = append(changed, field.name)
+		}
+	}
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&task).Select("name", "description", "priority", "start_date", "due_date").Updates(&task).Error; err != nil {
+			return err
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+		activity := models.TaskActivity{TaskID: task.ID, Actor: c.GetString("username"), Kind: models.ActivityUpdated, Subject: strings.Join(changed, ",")}
+		return tx.Create(&activity).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't update task: %s", err.Error())
 		return
 	}
 	data := struct {
@@ -263,3 +552,237 @@ func AssignTaskToUsers(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, utils.SuccessResponse(data))
 }
+
+// UpdateTaskPut replaces the name, description, priority and dates of a task. Dates left out are cleared.
+func UpdateTaskPut(c *gin.Context) {
+
+	task, ok := takeTask(c)
+	if !ok {
+		return
+	}
+	if !authorizeTaskUpdate(c, task) {
+		return
+	}
+
+	var body struct {
+		Name        string     `json:"name" validate:"required"`
+		Description string     `json:"description"`
+		Priority    string     `json:"priority" validate:"omitempty,oneof=low medium high urgent"`
+		StartDate   *time.Time `json:"start_date"`
+		DueDate     *time.Time `json:"due_date"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+	if len(strings.TrimSpace(body.Name)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Name must not be blank"))
+		return
+	}
+	if len(body.Priority) == 0 {
+		body.Priority = models.PriorityMedium
+	}
+
+	original := task
+	task.Name = body.Name
+	task.Description = body.Description
+	task.Priority = body.Priority
+	task.StartDate = body.StartDate
+	task.DueDate = body.DueDate
+	saveTaskDetails(c, original, task)
+}
+
+// taskDate reads a date of a PATCH body, where null clears the date.
+func taskDate(value interface{}) (*time.Time, bool) {
+	if value == nil {
+		return nil, true
+	}
+	text, ok := value.(string)
+	if !ok {
+		return nil, false
+	}
+	date, err := time.Parse(time.RFC3339, text)
+	if err != nil {
+		return nil, false
+	}
+	return &date, true
+}
+
+// UpdateTaskPatch changes only the fields present in the body. An empty description clears it,
+// as does null for a date.
+func UpdateTaskPatch(c *gin.Context) {
+
+	task, ok := takeTask(c)
+	if !ok {
+		return
+	}
+	if !authorizeTaskUpdate(c, task) {
+		return
+	}
+
+	requestBytes, err := io.ReadAll(c.Request.Body)
+	defer c.Request.Body.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	body := make(map[string]interface{})
+	if err = json.Unmarshal(requestBytes, &body); err != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	original := task
+	if value, ok := body["name"]; ok {
+		name, ok := value.(string)
+		if !ok || len(strings.TrimSpace(name)) == 0 {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Name must be a non-blank string"))
+			return
+		}
+		task.Name = name
+	}
+	if value, ok := body["description"]; ok {
+		description, ok := value.(string)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Description must be a string"))
+			return
+		}
+		task.Description = description
+	}
+	if value, ok := body["priority"]; ok {
+		priority, _ := value.(string)
+		switch priority {
+		case models.PriorityLow, models.PriorityMedium, models.PriorityHigh, models.PriorityUrgent:
+			task.Priority = priority
+		default:
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Priority must be one of low, medium, high, urgent"))
+			return
+		}
+	}
+	if value, ok := body["start_date"]; ok {
+		if task.StartDate, ok = taskDate(value); !ok {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Start Date must be an RFC 3339 date or null"))
+			return
+		}
+	}
+	if value, ok := body["due_date"]; ok {
+		if task.DueDate, ok = taskDate(value); !ok {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Due Date must be an RFC 3339 date or null"))
+			return
+		}
+	}
+	saveTaskDetails(c, original, task)
+}
+
+func takeTask(c *gin.Context) (models.Task, bool) {
+
+	var task models.Task
+	id := c.Param("id")
+	if len(strings.TrimSpace(id)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("ID is required"))
+		return task, false
+	}
+	if result := initializers.DB.Preload("Asignees").Take(&task, "id = ?", id); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse(fmt.Sprintf("Couldn't find task with id %s", id)))
+		return task, false
+	}
+	return task, true
+}
+
+// TransitionTask moves a task along the workflow. Its creator and asignees may unless denied, as well as anyone
+// allowed to update it; transitions gated by a permission additionally need that permission.
+func TransitionTask(c *gin.Context) {
+
+	task, ok := takeTask(c)
+	if !ok {
+		return
+	}
+	username := c.GetString("username")
+	decision, err := authz.DecideTask(username, "UPDATE", task, authz.RelationCreator, authz.RelationAsignee)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	if !decision.Allowed {
+		c.JSON(http.StatusForbidden, utils.ForbiddenResponse(decision.Reason))
+		return
+	}
+
+	var body struct {
+		To      string `json:"to" validate:"required"`
+		Comment string `json:"comment"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err = utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+
+	change, err := workflow.Transition(task, body.To, username, body.Comment)
+	if err != nil {
+		var illegal *workflow.IllegalTransitionError
+		var forbidden *workflow.ForbiddenTransitionError
+		switch {
+		case errors.Is(err, workflow.ErrUnknownState):
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse(fmt.Sprintf("Unknown state %s", body.To)))
+		case errors.As(err, &illegal):
+			c.JSON(http.StatusConflict, utils.ConflictResponse(illegal.Error()))
+		case errors.As(err, &forbidden):
+			c.JSON(http.StatusForbidden, utils.ForbiddenResponse(forbidden.Error()))
+		case errors.Is(err, workflow.ErrStaleStatus):
+			c.JSON(http.StatusConflict, utils.ConflictResponse("Task status changed meanwhile, reload and try again"))
+		default:
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			fmt.Printf("Couldn't transition task: %s", err.Error())
+		}
+		return
+	}
+	task.Status = change.To
+	data := struct {
+		Task   models.Task             `json:"task"`
+		Change models.TaskStatusChange `json:"change"`
+	}{
+		Task:   task,
+		Change: change,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// GetTaskTransitions returns the status history of a task and the states the caller may move it to.
+func GetTaskTransitions(c *gin.Context) {
+
+	task, ok := takeReadableTask(c)
+	if !ok {
+		return
+	}
+	available, err := workflow.Available(task, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch task transitions: %s", err.Error())
+		return
+	}
+	history, err := workflow.History(task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch task history: %s", err.Error())
+		return
+	}
+	data := struct {
+		Status    string                    `json:"status"`
+		Available []string                  `json:"available"`
+		History   []models.TaskStatusChange `json:"history"`
+	}{
+		Status:    task.Status,
+		Available: available,
+		History:   history,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/lockout"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/guptaharsh13/balkanid-task/twofactor"
+	"github.com/guptaharsh13/balkanid-task/utils"
+)
+
+func LoginTwoFactor(c *gin.Context) {
+
+	var body struct {
+		Challenge    string `json:"challenge" validate:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+	if len(body.Code) == 0 && len(body.RecoveryCode) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Code or Recovery Code required"))
+		return
+	}
+
+	challenge, err := twofactor.AttemptChallenge(body.Challenge)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrInvalidChallenge) {
+			c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Invalid or expired challenge"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch login challenge: %s", err.Error())
+		return
+	}
+	var user models.User
+	if result := initializers.DB.Take(&user, "username = ?", challenge.UserID); result.Error != nil || !user.IsActive {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Invalid or expired challenge"))
+		return
+	}
+	// Codes count against the same limits as passwords, which a new challenge per login doesn't reset.
+	account := lockout.Subject(user.Username)
+	ip := c.ClientIP()
+	wait, err := lockout.Attempt(account, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't check login throttle: %s", err.Error())
+		return
+	}
+	if wait > 0 {
+		tooManyAttempts(c, wait)
+		return
+	}
+
+	enabled, err := twofactor.Enabled(user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't check two-factor enrollment: %s", err.Error())
+		return
+	}
+	// A user who has to enroll before logging in confirms the enrollment with this step.
+	var recoveryCodes []string
+	if enabled {
+		err = twofactor.Verify(user.Username, body.Code, body.RecoveryCode)
+	} else {
+		recoveryCodes, err = twofactor.Confirm(user.Username, body.Code)
+	}
+	if err != nil {
+		if errors.Is(err, twofactor.ErrInvalidCode) {
+			if err := lockout.RecordFailure(account, ip); err != nil {
+				fmt.Printf("Couldn't record failed login: %s", err.Error())
+			}
+			c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Invalid code"))
+			return
+		}
+		if errors.Is(err, twofactor.ErrNotEnrolled) {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Two-factor authentication not enrolled"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't verify code: %s", err.Error())
+		return
+	}
+	if err := twofactor.CompleteChallenge(challenge); err != nil {
+		if errors.Is(err, twofactor.ErrInvalidChallenge) {
+			c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Invalid or expired challenge"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't complete login challenge: %s", err.Error())
+		return
+	}
+
+	pair, err := tokens.StartSession(user, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't create token: %s", err.Error())
+		return
+	}
+	if err := lockout.RecordSuccess(account, ip); err != nil {
+		fmt.Printf("Couldn't reset login throttle: %s", err.Error())
+	}
+	data := struct {
+		tokens.Pair
+		RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	}{
+		Pair:          pair,
+		RecoveryCodes: recoveryCodes,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// EnrollTwoFactorAtLogin lets a user who has to use two-factor authentication, but hasn't enrolled yet,
+// enroll with the challenge of the password step.
+func EnrollTwoFactorAtLogin(c *gin.Context) {
+
+	var body struct {
+		Challenge string `json:"challenge" validate:"required"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+
+	challenge, err := twofactor.TakeChallenge(body.Challenge)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrInvalidChallenge) {
+			c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Invalid or expired challenge"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch login challenge: %s", err.Error())
+		return
+	}
+	enrollTwoFactor(c, challenge.UserID)
+}
+
+func EnrollTwoFactor(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+	enrollTwoFactor(c, username.(string))
+}
+
+func enrollTwoFactor(c *gin.Context, username string) {
+
+	secret, uri, err := twofactor.Enroll(username)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrAlreadyEnabled) {
+			c.JSON(http.StatusConflict, utils.ConflictResponse("Two-factor authentication already enabled"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't enroll two-factor authentication: %s", err.Error())
+		return
+	}
+	data := struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}{
+		Secret:          secret,
+		ProvisioningURI: uri,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func ConfirmTwoFactor(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+
+	var body struct {
+		Code string `json:"code" validate:"required"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+
+	recoveryCodes, err := twofactor.Confirm(username.(string), body.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, twofactor.ErrInvalidCode):
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Invalid code"))
+		case errors.Is(err, twofactor.ErrNotEnrolled):
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Two-factor authentication not enrolled"))
+		case errors.Is(err, twofactor.ErrAlreadyEnabled):
+			c.JSON(http.StatusConflict, utils.ConflictResponse("Two-factor authentication already enabled"))
+		default:
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			fmt.Printf("Couldn't confirm two-factor authentication: %s", err.Error())
+		}
+		return
+	}
+	data := struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: recoveryCodes,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+
+	var body struct {
+		Code string `json:"code" validate:"required"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+
+	if err := twofactor.VerifyCode(username.(string), body.Code); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	recoveryCodes, err := twofactor.RegenerateRecoveryCodes(username.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't regenerate recovery codes: %s", err.Error())
+		return
+	}
+	data := struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: recoveryCodes,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func DisableTwoFactor(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+
+	var body struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+
+	var user models.User
+	if result := initializers.DB.Take(&user, "username = ?", username); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("User not found"))
+		return
+	}
+	required, err := twofactor.Required(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't check two-factor requirement: %s", err.Error())
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, utils.ForbiddenResponse("Two-factor authentication is required for this user"))
+		return
+	}
+	if err := twofactor.Verify(user.Username, body.Code, body.RecoveryCode); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	if err := twofactor.Disable(user.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't disable two-factor authentication: %s", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
+
+// ResetTwoFactor lets an administrator remove the enrollment of a user who lost both the device
+// and the recovery codes. The user's sessions are revoked as well.
+func ResetTwoFactor(c *gin.Context) {
+
+	username := c.Param("username")
+	if len(strings.TrimSpace(username)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Username is required"))
+		return
+	}
+	var user models.User
+	if result := initializers.DB.Take(&user, "username = ?", username); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("User not found"))
+		return
+	}
+	if err := twofactor.Disable(user.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't disable two-factor authentication: %s", err.Error())
+		return
+	}
+	if err := tokens.RevokeUser(user.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't revoke tokens: %s", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
+
+func respondTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, twofactor.ErrInvalidCode):
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Invalid code"))
+	case errors.Is(err, twofactor.ErrNotEnrolled):
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Two-factor authentication not enrolled"))
+	default:
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't verify code: %s", err.Error())
+	}
+}
@@ -4,18 +4,26 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
+	"github.com/guptaharsh13/balkanid-task/authz"
 	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/lockout"
+	"github.com/guptaharsh13/balkanid-task/mailer"
 	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/guptaharsh13/balkanid-task/twofactor"
 	"github.com/guptaharsh13/balkanid-task/utils"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 func Signup(c *gin.Context) {
@@ -72,6 +80,11 @@ func Signup(c *gin.Context) {
 	c.JSON(http.StatusOK, utils.SuccessResponse(data))
 }
 
+// verifyEmailTTL is how long an activation link works.
+const verifyEmailTTL = 15 * time.Hour
+
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), 10)
+
 func Login(c *gin.Context) {
 
 	var body struct {
@@ -91,42 +104,242 @@ func Login(c *gin.Context) {
 	}
 
 	var user models.User
+	var identifier string
+	var result *gorm.DB
 	if len(body.Username) > 0 {
-		initializers.DB.Take(&user, "username = ?", body.Username)
+		identifier = body.Username
+		result = initializers.DB.Limit(1).Find(&user, "username = ?", body.Username)
 	} else if len(body.Email) > 0 {
-		initializers.DB.Take(&user, "email = ?", body.Email)
+		identifier = body.Email
+		result = initializers.DB.Limit(1).Find(&user, "email = ?", body.Email)
 	} else {
 		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Username or Email required"))
 		return
 	}
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch user: %s", result.Error.Error())
+		return
+	}
+	found := result.RowsAffected > 0
+	account := lockout.Subject(identifier)
+	if found {
+		account = lockout.Subject(user.Username)
+	}
+	ip := c.ClientIP()
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password))
+	wait, err := lockout.Attempt(account, ip)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't check login throttle: %s", err.Error())
+		return
+	}
+	if wait > 0 {
+		tooManyAttempts(c, wait)
+		return
+	}
+
+	// Unknown users are compared against a dummy hash so they take as long as wrong passwords.
+	passwordHash := dummyPasswordHash
+	if found {
+		passwordHash = []byte(user.Password)
+	}
+	if err := bcrypt.CompareHashAndPassword(passwordHash, []byte(body.Password)); err != nil || !found {
+		if err := lockout.RecordFailure(account, ip); err != nil {
+			fmt.Printf("Couldn't record failed login: %s", err.Error())
+		}
 		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Invalid Credentials"))
 		return
 	}
-	if !user.IsActive {
-		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Email not verified"))
+	if !user.IsActive || user.IsServiceAccount {
+		if err := lockout.RecordFailure(account, ip); err != nil {
+			fmt.Printf("Couldn't record failed login: %s", err.Error())
+		}
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Invalid Credentials"))
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 24 * 15).Unix(),
-	})
+	// With a second factor due, the attempt stays counted until LoginTwoFactor accepts a code.
+	if completeLogin(c, user) {
+		if err := lockout.RecordSuccess(account, ip); err != nil {
+			fmt.Printf("Couldn't reset login throttle: %s", err.Error())
+		}
+	}
+}
+
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, utils.ErrorResponse(http.StatusTooManyRequests, "Too many failed logins, try again later"))
+}
+
+// completeLogin finishes the login of an authenticated user, asking for a second factor when one is due.
+// It reports whether the user was signed in.
+func completeLogin(c *gin.Context, user models.User) bool {
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	required, err := twofactor.Required(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't check two-factor requirement: %s", err.Error())
+		return false
+	}
+	enabled, err := twofactor.Enabled(user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't check two-factor enrollment: %s", err.Error())
+		return false
+	}
+	if required || enabled {
+		challenge, err := twofactor.NewChallenge(user.Username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			fmt.Printf("Couldn't create login challenge: %s", err.Error())
+			return false
+		}
+		data := struct {
+			TwoFactorRequired  bool   `json:"two_factor_required"`
+			EnrollmentRequired bool   `json:"enrollment_required"`
+			Challenge          string `json:"challenge"`
+			ExpiresIn          int64  `json:"expires_in"`
+		}{
+			TwoFactorRequired:  true,
+			EnrollmentRequired: !enabled,
+			Challenge:          challenge,
+			ExpiresIn:          int64(twofactor.ChallengeTTL().Seconds()),
+		}
+		c.JSON(http.StatusOK, utils.SuccessResponse(data))
+		return false
+	}
+
+	pair, err := tokens.StartSession(user, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
 		fmt.Printf("Couldn't create token: %s", err.Error())
+		return false
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(pair))
+	return true
+}
+
+func RefreshToken(c *gin.Context) {
+
+	var body struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
 		return
 	}
-	data := struct {
-		Token string `json:"token"`
-	}{
-		Token: tokenString,
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
 	}
-	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+
+	pair, err := tokens.Rotate(body.RefreshToken)
+	if err != nil {
+		if tokens.Rejected(err) {
+			c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse(tokens.Message(err)))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't rotate refresh token: %s", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(pair))
+}
+
+func Logout(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+	claims, ok := c.Get("claims")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if c.Request.ContentLength > 0 && c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+
+	if err := tokens.RevokeAccessToken(claims.(jwt.MapClaims)); err != nil && !tokens.Rejected(err) {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't revoke access token: %s", err.Error())
+		return
+	}
+	if sessionID, ok := claims.(jwt.MapClaims)["sid"].(string); ok {
+		if _, err := tokens.RevokeSession(username.(string), sessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			fmt.Printf("Couldn't revoke session: %s", err.Error())
+			return
+		}
+	}
+	if len(body.RefreshToken) > 0 {
+		if err := tokens.RevokeRefreshToken(body.RefreshToken, username.(string)); err != nil && !tokens.Rejected(err) {
+			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			fmt.Printf("Couldn't revoke refresh token: %s", err.Error())
+			return
+		}
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
+
+func ChangePassword(c *gin.Context) {
+
+	username, ok := c.Get("username")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+		return
+	}
+
+	var body struct {
+		CurrentPassword string `json:"current_password" validate:"required"`
+		NewPassword     string `json:"new_password" validate:"password,required"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+
+	var user models.User
+	if result := initializers.DB.Take(&user, "username = ?", username); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("User not found"))
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.CurrentPassword)); err != nil {
+		c.JSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Invalid Credentials"))
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), 10)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't hash password: %s", err.Error())
+		return
+	}
+	if result := initializers.DB.Model(&user).Update("password", string(hash)); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't update user: %s", result.Error.Error())
+		return
+	}
+	if err := tokens.RevokeUser(user.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't revoke tokens: %s", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
 }
 
 func VerifyEmail(c *gin.Context) {
@@ -150,7 +363,7 @@ func VerifyEmail(c *gin.Context) {
 	if result := initializers.DB.Take(&verifyEmail, "user_id = ?", user.Username); result.RowsAffected > 0 {
 
 		verifyEmail.Code = uuid.New().String()
-		verifyEmail.Expiration = time.Now().Add(time.Hour * 15)
+		verifyEmail.Expiration = time.Now().Add(verifyEmailTTL)
 		verifyEmail.IsUsed = false
 
 		if result := initializers.DB.Save(&verifyEmail); result.Error != nil {
@@ -162,7 +375,7 @@ func VerifyEmail(c *gin.Context) {
 		verifyEmail = models.VerifyEmail{
 			User:       user,
 			Code:       uuid.New().String(),
-			Expiration: time.Now().Add(time.Hour * 15),
+			Expiration: time.Now().Add(verifyEmailTTL),
 		}
 		if result := initializers.DB.Create(&verifyEmail); result.Error != nil {
 			c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
@@ -171,12 +384,20 @@ func VerifyEmail(c *gin.Context) {
 		}
 	}
 
-	data := struct {
-		Code string `json:"code"`
+	// The code only goes to the inbox, which is what proves the user owns the email.
+	link := fmt.Sprintf("%s/users/activate/%s/%s", mailer.AppURL(), url.PathEscape(user.Username), url.PathEscape(verifyEmail.Code))
+	data := mailer.LinkData{Username: user.Username, Link: link, ExpiresIn: mailer.FormatDuration(verifyEmailTTL)}
+	if err := mailer.Enqueue(user.Email, mailer.TemplateVerifyEmail, data); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't queue verification email: %s", err.Error())
+		return
+	}
+	response := struct {
+		Message string `json:"message"`
 	}{
-		Code: verifyEmail.Code,
+		Message: "Verification link sent to the email of the account",
 	}
-	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+	c.JSON(http.StatusOK, utils.SuccessResponse(response))
 }
 
 func ActivateUser(c *gin.Context) {
@@ -257,6 +478,11 @@ func DeactivateUser(c *gin.Context) {
 		fmt.Printf("Couldn't update user: %s", result.Error.Error())
 		return
 	}
+	if err := tokens.RevokeUser(user.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't revoke tokens: %s", err.Error())
+		return
+	}
 	data := struct {
 		User models.User `json:"user"`
 	}{
@@ -333,6 +559,11 @@ func DeleteUser(c *gin.Context) {
 		c.JSON(http.StatusNotFound, utils.NotFoundResponse("User not found"))
 		return
 	}
+	if err := tokens.RevokeUser(user.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't revoke tokens: %s", err.Error())
+		return
+	}
 	if result := initializers.DB.Unscoped().Delete(&user); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
 		fmt.Printf("Couldn't delete user: %s", result.Error.Error())
@@ -398,3 +629,109 @@ func BulkUploadUsers(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, utils.SuccessResponse(data))
 }
+
+func GetUserPermissions(c *gin.Context) {
+
+	username := c.Param("username")
+	if len(strings.TrimSpace(username)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Username is required"))
+		return
+	}
+	var user models.User
+	if result := initializers.DB.Take(&user, "username = ?", username); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("User not found"))
+		return
+	}
+	grants, err := authz.ResolveGrants(user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't resolve permissions: %s", err.Error())
+		return
+	}
+
+	explain := strings.TrimSpace(c.Query("explain"))
+	if len(explain) == 0 {
+		data := struct {
+			Username    string        `json:"username"`
+			IsAdmin     bool          `json:"is_admin"`
+			Permissions []authz.Grant `json:"permissions"`
+		}{
+			Username:    user.Username,
+			IsAdmin:     user.IsAdmin,
+			Permissions: grants,
+		}
+		c.JSON(http.StatusOK, utils.SuccessResponse(data))
+		return
+	}
+
+	if result := initializers.DB.Take(&models.Permission{}, "name = ?", explain); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Permission not found"))
+		return
+	}
+	sources := []authz.Source{}
+	effect := ""
+	for _, grant := range grants {
+		if grant.Permission.Name == explain {
+			sources = grant.Sources
+			effect = grant.Effect
+		}
+	}
+	// Only unconditional allows count as paths granting the permission; conditional and denying sources are
+	// listed on their own.
+	granting, conditional, denying := []authz.Source{}, []authz.Source{}, []authz.Source{}
+	for _, source := range sources {
+		switch {
+		case len(source.Condition) > 0:
+			conditional = append(conditional, source)
+		case source.Effect == models.EffectDeny:
+			denying = append(denying, source)
+		default:
+			granting = append(granting, source)
+		}
+	}
+	conditionalDenies := 0
+	for _, source := range conditional {
+		if source.Effect == models.EffectDeny {
+			conditionalDenies++
+		}
+	}
+	// Inactive users are refused everything, whatever they are granted.
+	var reason string
+	switch {
+	case !user.IsActive:
+		reason = fmt.Sprintf("%s is inactive and is refused every permission", user.Username)
+	case user.IsAdmin:
+		reason = fmt.Sprintf("%s is an admin and is granted every permission", user.Username)
+	case effect == models.EffectDeny:
+		reason = fmt.Sprintf("%s is denied %s by at least one role or group, which overrides any grant", user.Username, explain)
+	case effect == models.EffectAllow && conditionalDenies > 0:
+		reason = fmt.Sprintf("%s is granted %s through %d role(s)/group(s), except where the conditions of %d denying role(s)/group(s) hold",
+			user.Username, explain, len(granting), conditionalDenies)
+	case effect == models.EffectAllow:
+		reason = fmt.Sprintf("%s is granted %s through %d role(s)/group(s)", user.Username, explain, len(granting))
+	case effect == authz.EffectConditional:
+		reason = fmt.Sprintf("%s is granted %s only where the conditions of its sources hold", user.Username, explain)
+	default:
+		reason = fmt.Sprintf("No role or group grants %s to %s", explain, user.Username)
+	}
+	data := struct {
+		Username    string         `json:"username"`
+		Permission  string         `json:"permission"`
+		Granted     bool           `json:"granted"`
+		Sources     []authz.Source `json:"sources"`
+		Granting    []authz.Source `json:"granting"`
+		Conditional []authz.Source `json:"conditional"`
+		Denying     []authz.Source `json:"denying"`
+		Reason      string         `json:"reason"`
+	}{
+		Username:    user.Username,
+		Permission:  explain,
+		Granted:     user.IsActive && (user.IsAdmin || effect == models.EffectAllow && conditionalDenies == 0),
+		Sources:     sources,
+		Granting:    granting,
+		Conditional: conditional,
+		Denying:     denying,
+		Reason:      reason,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
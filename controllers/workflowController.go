@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/utils"
+	"gorm.io/gorm"
+)
+
+func GetWorkflow(c *gin.Context) {
+
+	var states []models.TaskState
+	if result := initializers.DB.Order("id").Find(&states); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch task states: %s", result.Error.Error())
+		return
+	}
+	var transitions []models.TaskTransition
+	if result := initializers.DB.Order("id").Find(&transitions); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't fetch task transitions: %s", result.Error.Error())
+		return
+	}
+	data := struct {
+		States      []models.TaskState      `json:"states"`
+		Transitions []models.TaskTransition `json:"transitions"`
+	}{
+		States:      states,
+		Transitions: transitions,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// saveTaskState saves state, taking the initial flag away from every other state when state is initial.
+func saveTaskState(state *models.TaskState) error {
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if state.IsInitial {
+			if err := tx.Model(&models.TaskState{}).Where("id <> ?", state.ID).Update("is_initial", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(state).Error
+	})
+}
+
+func CreateTaskState(c *gin.Context) {
+
+	var body struct {
+		Name        string `json:"name" validate:"required"`
+		Description string `json:"description"`
+		IsInitial   bool   `json:"is_initial"`
+		IsFinal     bool   `json:"is_final"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+	if result := initializers.DB.Take(&models.TaskState{}, "name = ?", body.Name); result.RowsAffected > 0 {
+		c.JSON(http.StatusConflict, utils.ConflictResponse("State already exists"))
+		return
+	}
+
+	state := models.TaskState{Name: body.Name, Description: body.Description, IsInitial: body.IsInitial, IsFinal: body.IsFinal}
+	if err := saveTaskState(&state); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't create task state: %s", err.Error())
+		return
+	}
+	data := struct {
+		State models.TaskState `json:"state"`
+	}{
+		State: state,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// UpdateTaskState changes the description and flags of a state. Names can't change, since tasks refer to them.
+func UpdateTaskState(c *gin.Context) {
+
+	name := c.Param("name")
+	if len(strings.TrimSpace(name)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Name is required"))
+		return
+	}
+	var state models.TaskState
+	if result := initializers.DB.Take(&state, "name = ?", name); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find state"))
+		return
+	}
+
+	requestBytes, err := io.ReadAll(c.Request.Body)
+	defer c.Request.Body.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	body := make(map[string]interface{})
+	if err = json.Unmarshal(requestBytes, &body); err != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	if value, ok := body["description"]; ok {
+		description, ok := value.(string)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Description must be a string"))
+			return
+		}
+		state.Description = description
+	}
+	if value, ok := body["is_initial"]; ok {
+		isInitial, ok := value.(bool)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Is Initial must be a boolean"))
+			return
+		}
+		if !isInitial && state.IsInitial {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Make another state initial instead"))
+			return
+		}
+		state.IsInitial = isInitial
+	}
+	if value, ok := body["is_final"]; ok {
+		isFinal, ok := value.(bool)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Is Final must be a boolean"))
+			return
+		}
+		state.IsFinal = isFinal
+	}
+
+	if err := saveTaskState(&state); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't update task state: %s", err.Error())
+		return
+	}
+	data := struct {
+		State models.TaskState `json:"state"`
+	}{
+		State: state,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+// DeleteTaskState removes a state along with its transitions. States tasks are in can't be removed.
+func DeleteTaskState(c *gin.Context) {
+
+	name := c.Param("name")
+	if len(strings.TrimSpace(name)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Name is required"))
+		return
+	}
+	var state models.TaskState
+	if result := initializers.DB.Take(&state, "name = ?", name); result.Error != nil {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse("Couldn't find state"))
+		return
+	}
+	if state.IsInitial {
+		c.JSON(http.StatusConflict, utils.ConflictResponse("Can't delete the initial state"))
+		return
+	}
+	var tasks int64
+	if result := initializers.DB.Model(&models.Task{}).Where("status = ?", state.Name).Count(&tasks); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	if tasks > 0 {
+		c.JSON(http.StatusConflict, utils.ConflictResponse(fmt.Sprintf("%d tasks are %s", tasks, state.Name)))
+		return
+	}
+	if result := initializers.DB.Delete(&state); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't delete task state: %s", result.Error.Error())
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
+
+func CreateTaskTransition(c *gin.Context) {
+
+	var body struct {
+		From       string `json:"from" validate:"required"`
+		To         string `json:"to" validate:"required"`
+		Permission string `json:"permission"`
+	}
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Bad Request"))
+		return
+	}
+	err := utils.ValidateStruct(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.ValidationErrorResponse(err))
+		return
+	}
+	if body.From == body.To {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("A transition must change the state"))
+		return
+	}
+	var states int64
+	if result := initializers.DB.Model(&models.TaskState{}).Where("name IN ?", []string{body.From, body.To}).Count(&states); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	if states != 2 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("Couldn't find both states"))
+		return
+	}
+	if len(body.Permission) > 0 {
+		if result := initializers.DB.Take(&models.Permission{}, "name = ?", body.Permission); result.Error != nil {
+			c.JSON(http.StatusBadRequest, utils.BadRequestResponse(fmt.Sprintf("Couldn't find permission %s", body.Permission)))
+			return
+		}
+	}
+	if result := initializers.DB.Take(&models.TaskTransition{}, "from_state = ? AND to_state = ?", body.From, body.To); result.RowsAffected > 0 {
+		c.JSON(http.StatusConflict, utils.ConflictResponse("Transition already exists"))
+		return
+	}
+
+	transition := models.TaskTransition{From: body.From, To: body.To, Permission: body.Permission}
+	if result := initializers.DB.Create(&transition); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't create task transition: %s", result.Error.Error())
+		return
+	}
+	data := struct {
+		Transition models.TaskTransition `json:"transition"`
+	}{
+		Transition: transition,
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(data))
+}
+
+func DeleteTaskTransition(c *gin.Context) {
+
+	id := c.Param("id")
+	if len(strings.TrimSpace(id)) == 0 {
+		c.JSON(http.StatusBadRequest, utils.BadRequestResponse("ID is required"))
+		return
+	}
+	result := initializers.DB.Delete(&models.TaskTransition{}, "id = ?", id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		fmt.Printf("Couldn't delete task transition: %s", result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, utils.NotFoundResponse(fmt.Sprintf("Couldn't find transition with id %s", id)))
+		return
+	}
+	c.JSON(http.StatusOK, utils.SuccessResponse(nil))
+}
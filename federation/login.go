@@ -0,0 +1,393 @@
+package federation
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidState    = errors.New("invalid or expired login state")
+	ErrInvalidCode     = errors.New("invalid authorization code")
+	ErrInvalidIDToken  = errors.New("invalid id_token")
+	ErrMissingEmail    = errors.New("identity provider didn't release an email")
+	ErrUnverifiedEmail = errors.New("email of an existing account isn't verified by the identity provider")
+	ErrUnverifiedUser  = errors.New("existing account with the email hasn't verified it")
+	ErrNotProvisioned  = errors.New("no account for the identity and auto-provisioning is off")
+	ErrInactiveUser    = errors.New("user inactive")
+)
+
+// Rejected reports whether err means the login must be refused, as opposed to a failure completing it.
+func Rejected(err error) bool {
+	return errors.Is(err, ErrInvalidState) || errors.Is(err, ErrInvalidCode) || errors.Is(err, ErrInvalidIDToken) ||
+		errors.Is(err, ErrMissingEmail) || errors.Is(err, ErrUnverifiedEmail) || errors.Is(err, ErrUnverifiedUser) ||
+		errors.Is(err, ErrNotProvisioned) ||
+		errors.Is(err, ErrInactiveUser)
+}
+
+func Message(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidState):
+		return "Login expired, please start again"
+	case errors.Is(err, ErrMissingEmail):
+		return "The identity provider didn't share your email"
+	case errors.Is(err, ErrUnverifiedEmail):
+		return "An account with your email exists, but the identity provider hasn't verified the email"
+	case errors.Is(err, ErrUnverifiedUser):
+		return "An account with your email exists, but hasn't verified the email yet"
+	case errors.Is(err, ErrNotProvisioned):
+		return "No account found for your identity"
+	case errors.Is(err, ErrInactiveUser):
+		return "User inactive"
+	}
+	return "Couldn't verify your identity"
+}
+
+func randomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// StateCookie binds a federated login to the browser that started it, so a callback URL carrying someone
+// else's state and code can't complete a login in another browser.
+const StateCookie = "federated_login"
+
+// SecureCookies reports whether cookies should only be sent over https, which is the case unless the
+// callback itself is served over plain http.
+func SecureCookies() bool {
+	return !strings.HasPrefix(settings.RedirectURI, "http://")
+}
+
+// LoginTTL is how long a federated login may take.
+func LoginTTL() time.Duration {
+	return settings.LoginTTL
+}
+
+// Begin starts a federated login and returns the URL of the identity provider to send the user to, and
+// the value of StateCookie for the browser. The state, nonce and PKCE verifier stay on the server until
+// the provider redirects back.
+func Begin() (string, string, error) {
+
+	metadata, err := provider.discover()
+	if err != nil {
+		return "", "", err
+	}
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	record := models.FederatedLoginState{
+		StateHash:    tokens.Hash(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(settings.LoginTTL),
+	}
+	if result := initializers.DB.Create(&record); result.Error != nil {
+		return "", "", result.Error
+	}
+
+	target, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := target.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", settings.ClientID)
+	query.Set("redirect_uri", settings.RedirectURI)
+	query.Set("scope", strings.Join(settings.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	target.RawQuery = query.Encode()
+	return target.String(), record.StateHash, nil
+}
+
+// Complete finishes a federated login with the code the identity provider redirected back with, in the browser
+// that sent cookie. It returns the linked user, provisioning or linking one on first login, with memberships
+// synced from the provider groups.
+func Complete(state string, code string, cookie string) (models.User, error) {
+
+	var user models.User
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(tokens.Hash(state))) != 1 {
+		return user, ErrInvalidState
+	}
+	var pending models.FederatedLoginState
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Take(&pending, "state_hash = ?", tokens.Hash(state))
+		if result.Error != nil {
+			return result.Error
+		}
+		// A replayed or raced callback finds the state already deleted by the first one.
+		result = tx.Delete(&models.FederatedLoginState{}, "state_hash = ?", pending.StateHash)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, ErrInvalidState
+	}
+	if err != nil {
+		return user, err
+	}
+	if pending.ExpiresAt.Before(time.Now()) {
+		return user, ErrInvalidState
+	}
+
+	metadata, err := provider.discover()
+	if err != nil {
+		return user, err
+	}
+	response, err := exchange(metadata, code, pending.CodeVerifier)
+	if err != nil {
+		return user, err
+	}
+	identity, err := verifyIDToken(response.IDToken, pending.Nonce)
+	if err != nil {
+		return user, err
+	}
+	if !identity.hasGroups {
+		if err := userInfo(metadata, response.AccessToken, &identity); err != nil {
+			return user, err
+		}
+	}
+
+	user, err = resolveUser(identity)
+	if err != nil {
+		return user, err
+	}
+	if identity.hasGroups {
+		if err := SyncMemberships(user, identity.Groups); err != nil {
+			return user, err
+		}
+	}
+	return user, nil
+}
+
+// resolveUser finds the user linked to identity. On first login it links the account with the same email,
+// or else provisions a new account. An account is only linked when both the provider and the account verified
+// the email, since anyone can sign up with an address they don't own and pick the password.
+func resolveUser(identity Identity) (models.User, error) {
+
+	var user models.User
+	var link models.FederatedIdentity
+	result := initializers.DB.Limit(1).Find(&link, "issuer = ? AND subject = ?", settings.Issuer, identity.Subject)
+	if result.Error != nil {
+		return user, result.Error
+	}
+	if result.RowsAffected > 0 {
+		if result := initializers.DB.Take(&user, "username = ?", link.UserID); result.Error != nil {
+			return user, result.Error
+		}
+		if !user.IsActive || user.IsServiceAccount {
+			return user, ErrInactiveUser
+		}
+		result := initializers.DB.Model(&link).Updates(map[string]interface{}{"email": identity.Email, "last_login_at": time.Now()})
+		return user, result.Error
+	}
+
+	if len(identity.Email) == 0 {
+		return user, ErrMissingEmail
+	}
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Limit(1).Find(&user, "email = ?", identity.Email)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			if !identity.EmailVerified {
+				return ErrUnverifiedEmail
+			}
+			// Accounts become active once their email is verified, so an inactive one may not belong to
+			// the owner of the address.
+			if !user.IsActive {
+				return ErrUnverifiedUser
+			}
+			if user.IsServiceAccount {
+				return ErrInactiveUser
+			}
+		} else {
+			if !settings.AutoProvision {
+				return ErrNotProvisioned
+			}
+			provisioned, err := provisionUser(tx, identity)
+			if err != nil {
+				return err
+			}
+			user = provisioned
+		}
+		return tx.Create(&models.FederatedIdentity{
+			Issuer:      settings.Issuer,
+			Subject:     identity.Subject,
+			UserID:      user.Username,
+			Email:       identity.Email,
+			LastLoginAt: time.Now(),
+		}).Error
+	})
+	return user, err
+}
+
+var usernameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// provisionUser creates the account of a user seen for the first time. It gets an unusable password,
+// so it can only log in through the provider until the user resets it.
+func provisionUser(tx *gorm.DB, identity Identity) (models.User, error) {
+
+	var user models.User
+	base := identity.PreferredUsername
+	if len(base) == 0 {
+		base = strings.Split(identity.Email, "@")[0]
+	}
+	base = usernameCharacters.ReplaceAllString(base, "")
+	if len(base) > 20 {
+		base = base[:20]
+	}
+	if len(base) < 5 {
+		base = base + "-user"
+	}
+	username := base
+	for suffix := 2; ; suffix++ {
+		var taken int64
+		if result := tx.Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&taken); result.Error != nil {
+			return user, result.Error
+		}
+		if taken == 0 {
+			break
+		}
+		username = fmt.Sprintf("%s%d", base, suffix)
+	}
+
+	password, err := randomString()
+	if err != nil {
+		return user, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return user, err
+	}
+	user = models.User{
+		Username: username,
+		Email:    identity.Email,
+		Password: string(hash),
+		IsActive: true,
+	}
+	return user, tx.Create(&user).Error
+}
+
+// SyncMemberships makes the federated memberships of user match the group mappings its provider groups match.
+// Memberships granted by admins are left alone.
+func SyncMemberships(user models.User, providerGroups []string) error {
+
+	var mappings []models.GroupMapping
+	if result := initializers.DB.Find(&mappings); result.Error != nil {
+		return result.Error
+	}
+	wanted := map[string][]string{}
+	for _, mapping := range mappings {
+		for _, group := range providerGroups {
+			if matched, _ := path.Match(mapping.Claim, group); matched {
+				wanted[mapping.Kind] = append(wanted[mapping.Kind], mapping.Name)
+				break
+			}
+		}
+	}
+
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var groups []models.Group
+		if len(wanted[models.MappingGroup]) > 0 {
+			if result := tx.Where("name IN ?", wanted[models.MappingGroup]).Find(&groups); result.Error != nil {
+				return result.Error
+			}
+		}
+		groupNames := []string{}
+		memberships := []models.UserGroup{}
+		for _, group := range groups {
+			groupNames = append(groupNames, group.Name)
+			memberships = append(memberships, models.UserGroup{
+				UserID:       user.ID,
+				UserUsername: user.Username,
+				GroupID:      group.ID,
+				GroupName:    group.Name,
+				Source:       models.MembershipFederated,
+			})
+		}
+		if len(memberships) > 0 {
+			if result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&memberships); result.Error != nil {
+				return result.Error
+			}
+		}
+		stale := tx.Where("user_username = ? AND source = ?", user.Username, models.MembershipFederated)
+		if len(groupNames) > 0 {
+			stale = stale.Where("group_name NOT IN ?", groupNames)
+		}
+		if result := stale.Delete(&models.UserGroup{}); result.Error != nil {
+			return result.Error
+		}
+
+		var roles []models.Role
+		if len(wanted[models.MappingRole]) > 0 {
+			if result := tx.Where("name IN ?", wanted[models.MappingRole]).Find(&roles); result.Error != nil {
+				return result.Error
+			}
+		}
+		roleNames := []string{}
+		roleMemberships := []models.UserRole{}
+		for _, role := range roles {
+			roleNames = append(roleNames, role.Name)
+			roleMemberships = append(roleMemberships, models.UserRole{
+				UserID:       user.ID,
+				UserUsername: user.Username,
+				RoleID:       role.ID,
+				RoleName:     role.Name,
+				Source:       models.MembershipFederated,
+			})
+		}
+		if len(roleMemberships) > 0 {
+			if result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&roleMemberships); result.Error != nil {
+				return result.Error
+			}
+		}
+		stale = tx.Where("user_username = ? AND source = ?", user.Username, models.MembershipFederated)
+		if len(roleNames) > 0 {
+			stale = stale.Where("role_name NOT IN ?", roleNames)
+		}
+		return stale.Delete(&models.UserRole{}).Error
+	})
+}
+
+// PurgeExpiredStates deletes federated logins that were never completed.
+func PurgeExpiredStates(now time.Time) (int64, error) {
+	result := initializers.DB.Delete(&models.FederatedLoginState{}, "expires_at < ?", now)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,411 @@
+package federation
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt"
+	"github.com/guptaharsh13/balkanid-task/config"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const mockClientID = "balkanid-task"
+
+// mockIdP is an identity provider served by httptest. Codes are handed out by issue instead of a login
+// page, each carrying the claims of the id_token and userinfo response it's redeemed for.
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu        sync.Mutex
+	kid       string
+	key       *rsa.PrivateKey
+	published map[string]*rsa.PrivateKey
+	codes     map[string]jwt.MapClaims
+	userinfo  map[string]jwt.MapClaims
+	jwksHits  int
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+
+	idp := &mockIdP{
+		t:         t,
+		published: map[string]*rsa.PrivateKey{},
+		codes:     map[string]jwt.MapClaims{},
+		userinfo:  map[string]jwt.MapClaims{},
+	}
+	idp.rotate()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			UserInfoEndpoint:      idp.server.URL + "/userinfo",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksHits++
+		keys := []jwk{}
+		for kid, key := range idp.published {
+			keys = append(keys, jwk{
+				KeyType: "RSA",
+				KeyID:   kid,
+				Use:     "sig",
+				N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		claims, ok := idp.codes[r.PostFormValue("code")]
+		delete(idp.codes, r.PostFormValue("code"))
+		kid, key := idp.kid, idp.key
+		idp.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			t.Errorf("Couldn't sign id_token: %s", err)
+		}
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: "access-" + claims["sub"].(string), IDToken: idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		claims, ok := idp.userinfo[r.Header.Get("Authorization")]
+		idp.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(claims)
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// rotate signs with a new key from now on. The old key stays published, as providers do for a while.
+func (idp *mockIdP) rotate() {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		idp.t.Fatalf("Couldn't generate key: %s", err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.kid = fmt.Sprintf("key-%d", len(idp.published)+1)
+	idp.key = key
+	idp.published[idp.kid] = key
+}
+
+// issue hands out a code for an id_token with claims. Groups are only released through userinfo.
+func (idp *mockIdP) issue(nonce string, claims jwt.MapClaims, groups []string) string {
+
+	idToken := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   mockClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": nonce,
+	}
+	for name, value := range claims {
+		idToken[name] = value
+	}
+	code := fmt.Sprintf("code-%d", time.Now().UnixNano())
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.codes[code] = idToken
+	userinfo := jwt.MapClaims{"sub": claims["sub"]}
+	if groups != nil {
+		userinfo["groups"] = groups
+	}
+	idp.userinfo["Bearer access-"+claims["sub"].(string)] = userinfo
+	return code
+}
+
+func setup(t *testing.T, autoProvision bool) *mockIdP {
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Couldn't open database: %s", err)
+	}
+	initializers.DB = db
+	initializers.SyncDatabase()
+
+	idp := newMockIdP(t)
+	Configure(config.FederationConfig{
+		Issuer:        idp.server.URL,
+		ClientID:      mockClientID,
+		RedirectURI:   "http://localhost:3000/users/login/oidc/callback",
+		Scopes:        []string{"openid", "email", "profile"},
+		GroupsClaim:   "groups",
+		AutoProvision: autoProvision,
+		LoginTTL:      5 * time.Minute,
+	})
+	return idp
+}
+
+// pendingLogin is a login started with Begin, as seen by the browser.
+type pendingLogin struct {
+	state  string
+	nonce  string
+	cookie string
+}
+
+func begin(t *testing.T) pendingLogin {
+
+	target, cookie, err := Begin()
+	if err != nil {
+		t.Fatalf("Couldn't begin login: %s", err)
+	}
+	parsed, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("Couldn't parse authorization URL: %s", err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != mockClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("Authorization URL is %s", target)
+	}
+	return pendingLogin{state: query.Get("state"), nonce: query.Get("nonce"), cookie: cookie}
+}
+
+// login runs a whole federated login of the identity with claims and groups.
+func login(t *testing.T, idp *mockIdP, claims jwt.MapClaims, groups []string) (models.User, error) {
+	pending := begin(t)
+	return Complete(pending.state, idp.issue(pending.nonce, claims, groups), pending.cookie)
+}
+
+func linkedTo(t *testing.T, subject string) string {
+	var link models.FederatedIdentity
+	if result := initializers.DB.Limit(1).Find(&link, "subject = ?", subject); result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	return link.UserID
+}
+
+func TestAutoProvisioning(t *testing.T) {
+
+	idp := setup(t, true)
+	claims := jwt.MapClaims{"sub": "sub-1", "email": "new.user@example.com", "email_verified": true, "preferred_username": "new.user"}
+	user, err := login(t, idp, claims, nil)
+	if err != nil {
+		t.Fatalf("Login failed: %s", err)
+	}
+	if user.Username != "new.user" || !user.IsActive || user.Email != "new.user@example.com" {
+		t.Fatalf("Provisioned user is %+v", user)
+	}
+	if linkedTo(t, "sub-1") != "new.user" {
+		t.Fatalf("Identity isn't linked to the provisioned user")
+	}
+
+	again, err := login(t, idp, claims, nil)
+	if err != nil || again.Username != user.Username {
+		t.Fatalf("Second login got %+v, %v", again, err)
+	}
+}
+
+func TestNoAutoProvisioning(t *testing.T) {
+
+	idp := setup(t, false)
+	_, err := login(t, idp, jwt.MapClaims{"sub": "sub-1", "email": "new.user@example.com", "email_verified": true}, nil)
+	if !errors.Is(err, ErrNotProvisioned) {
+		t.Fatalf("Login got %v, want ErrNotProvisioned", err)
+	}
+}
+
+func TestLinkVerifiedEmail(t *testing.T) {
+
+	idp := setup(t, true)
+	initializers.DB.Create(&models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true})
+
+	user, err := login(t, idp, jwt.MapClaims{"sub": "sub-alice", "email": "alice@example.com", "email_verified": true}, nil)
+	if err != nil {
+		t.Fatalf("Login failed: %s", err)
+	}
+	if user.Username != "alice" || linkedTo(t, "sub-alice") != "alice" {
+		t.Fatalf("Identity wasn't linked to the existing account, got %+v", user)
+	}
+}
+
+func TestUnverifiedEmailConflict(t *testing.T) {
+
+	idp := setup(t, true)
+	initializers.DB.Create(&models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true})
+
+	_, err := login(t, idp, jwt.MapClaims{"sub": "sub-alice", "email": "alice@example.com", "email_verified": false}, nil)
+	if !errors.Is(err, ErrUnverifiedEmail) {
+		t.Fatalf("Login got %v, want ErrUnverifiedEmail", err)
+	}
+	if linkedTo(t, "sub-alice") != "" {
+		t.Fatalf("Identity was linked despite the unverified email")
+	}
+}
+
+// Someone who signs up with the email of another person mustn't get their identity linked to the account.
+func TestUnverifiedAccountNotLinked(t *testing.T) {
+
+	idp := setup(t, true)
+	initializers.DB.Create(&models.User{Username: "squatter", Email: "victim@example.com", Password: "x", IsActive: false})
+
+	_, err := login(t, idp, jwt.MapClaims{"sub": "sub-victim", "email": "victim@example.com", "email_verified": true}, nil)
+	if !errors.Is(err, ErrUnverifiedUser) {
+		t.Fatalf("Login got %v, want ErrUnverifiedUser", err)
+	}
+	if linkedTo(t, "sub-victim") != "" {
+		t.Fatalf("Identity was linked to an account that never verified the email")
+	}
+}
+
+func TestMembershipSync(t *testing.T) {
+
+	idp := setup(t, true)
+	engineering := models.Group{Name: "engineering"}
+	support := models.Group{Name: "support"}
+	reviewer := models.Role{Name: "reviewer"}
+	initializers.DB.Create(&engineering)
+	initializers.DB.Create(&support)
+	initializers.DB.Create(&reviewer)
+	initializers.DB.Create(&[]models.GroupMapping{
+		{Claim: "eng-*", Kind: models.MappingGroup, Name: "engineering"},
+		{Claim: "reviewers", Kind: models.MappingRole, Name: "reviewer"},
+	})
+	claims := jwt.MapClaims{"sub": "sub-1", "email": "bob@example.com", "email_verified": true, "preferred_username": "bob.builder"}
+
+	user, err := login(t, idp, claims, []string{"eng-backend", "reviewers", "unmapped"})
+	if err != nil {
+		t.Fatalf("Login failed: %s", err)
+	}
+	// Memberships granted by admins aren't the provider's to remove.
+	initializers.DB.Create(&models.UserGroup{UserID: user.ID, UserUsername: user.Username, GroupID: support.ID, GroupName: "support"})
+
+	groups := func() map[string]string {
+		var memberships []models.UserGroup
+		initializers.DB.Find(&memberships, "user_username = ?", user.Username)
+		found := map[string]string{}
+		for _, membership := range memberships {
+			found[membership.GroupName] = membership.Source
+		}
+		return found
+	}
+	roles := func() int64 {
+		var count int64
+		initializers.DB.Model(&models.UserRole{}).Where("user_username = ? AND role_name = ?", user.Username, "reviewer").Count(&count)
+		return count
+	}
+	if found := groups(); found["engineering"] != models.MembershipFederated || found["support"] != "" || len(found) != 2 {
+		t.Fatalf("Groups after first login are %v", found)
+	}
+	if roles() != 1 {
+		t.Fatalf("Mapped role wasn't granted")
+	}
+
+	if _, err := login(t, idp, claims, []string{"sales"}); err != nil {
+		t.Fatalf("Second login failed: %s", err)
+	}
+	if found := groups(); len(found) != 1 || found["support"] != "" {
+		t.Fatalf("Groups after the provider dropped them are %v", found)
+	}
+	if roles() != 0 {
+		t.Fatalf("Stale federated role wasn't removed")
+	}
+}
+
+func TestStateReplay(t *testing.T) {
+
+	idp := setup(t, true)
+	claims := jwt.MapClaims{"sub": "sub-1", "email": "new.user@example.com", "email_verified": true}
+	pending := begin(t)
+	code := idp.issue(pending.nonce, claims, nil)
+	if _, err := Complete(pending.state, code, pending.cookie); err != nil {
+		t.Fatalf("Login failed: %s", err)
+	}
+	if _, err := Complete(pending.state, code, pending.cookie); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("Replayed state got %v, want ErrInvalidState", err)
+	}
+}
+
+// A callback URL opened in another browser than the one that started the login is refused.
+func TestStateBoundToBrowser(t *testing.T) {
+
+	idp := setup(t, true)
+	pending := begin(t)
+	other := begin(t)
+	code := idp.issue(pending.nonce, jwt.MapClaims{"sub": "sub-1", "email": "new.user@example.com", "email_verified": true}, nil)
+	if _, err := Complete(pending.state, code, other.cookie); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("Login with another browser's cookie got %v, want ErrInvalidState", err)
+	}
+	if _, err := Complete(pending.state, code, ""); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("Login without cookie got %v, want ErrInvalidState", err)
+	}
+}
+
+func TestNonceReplay(t *testing.T) {
+
+	idp := setup(t, true)
+	claims := jwt.MapClaims{"sub": "sub-1", "email": "new.user@example.com", "email_verified": true}
+	first := begin(t)
+	if _, err := Complete(first.state, idp.issue(first.nonce, claims, nil), first.cookie); err != nil {
+		t.Fatalf("Login failed: %s", err)
+	}
+	// An id_token issued for an earlier login doesn't complete a new one.
+	second := begin(t)
+	if _, err := Complete(second.state, idp.issue(first.nonce, claims, nil), second.cookie); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("Replayed nonce got %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+
+	idp := setup(t, true)
+	claims := jwt.MapClaims{"sub": "sub-1", "email": "new.user@example.com", "email_verified": true}
+	if _, err := login(t, idp, claims, nil); err != nil {
+		t.Fatalf("Login failed: %s", err)
+	}
+
+	// Unknown kids refetch the keys at most once per jwksRefreshInterval.
+	idp.rotate()
+	if _, err := login(t, idp, claims, nil); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("Login right after rotation got %v, want ErrInvalidIDToken", err)
+	}
+	if idp.jwksHits != 1 {
+		t.Fatalf("Keys were fetched %d times, want 1", idp.jwksHits)
+	}
+
+	provider.mu.Lock()
+	provider.loadedAt = provider.loadedAt.Add(-jwksRefreshInterval)
+	provider.mu.Unlock()
+	if _, err := login(t, idp, claims, nil); err != nil {
+		t.Fatalf("Login with the rotated key failed: %s", err)
+	}
+	if idp.jwksHits != 2 {
+		t.Fatalf("Keys were fetched %d times, want 2", idp.jwksHits)
+	}
+}
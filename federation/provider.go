@@ -0,0 +1,382 @@
+package federation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/guptaharsh13/balkanid-task/config"
+)
+
+// jwksRefreshInterval bounds how often an unknown kid makes the provider keys be fetched again.
+const jwksRefreshInterval = time.Minute
+
+var (
+	settings   config.FederationConfig
+	httpClient = &http.Client{Timeout: 10 * time.Second}
+	provider   = &identityProvider{}
+)
+
+// Configure sets the identity provider. Its discovery document is fetched on the first login.
+func Configure(federation config.FederationConfig) {
+	settings = federation
+	settings.Issuer = strings.TrimSuffix(federation.Issuer, "/")
+	provider = &identityProvider{}
+}
+
+func Enabled() bool {
+	return len(settings.Issuer) > 0 && len(settings.ClientID) > 0
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+type identityProvider struct {
+	mu       sync.Mutex
+	metadata *discovery
+	keys     map[string]crypto.PublicKey
+	loadedAt time.Time
+}
+
+func getJSON(endpoint string, target interface{}) error {
+
+	response, err := httpClient.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", endpoint, response.Status)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(target)
+}
+
+func (p *identityProvider) discover() (*discovery, error) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	var metadata discovery
+	if err := getJSON(settings.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != settings.Issuer {
+		return nil, fmt.Errorf("identity provider reports issuer %s instead of %s", metadata.Issuer, settings.Issuer)
+	}
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// key returns the public key with kid, fetching the keys again when the provider rotated to an unknown one.
+func (p *identityProvider) key(kid string) (crypto.PublicKey, error) {
+
+	metadata, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.loadedAt) < jwksRefreshInterval {
+		return nil, ErrInvalidIDToken
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(metadata.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, key := range set.Keys {
+		if len(key.Use) > 0 && key.Use != "sig" {
+			continue
+		}
+		public, err := key.publicKey()
+		if err != nil {
+			fmt.Printf("Couldn't parse key %s of identity provider: %s\n", key.KeyID, err.Error())
+			continue
+		}
+		keys[key.KeyID] = public
+	}
+	p.keys = keys
+	p.loadedAt = time.Now()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrInvalidIDToken
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+func (key jwk) publicKey() (crypto.PublicKey, error) {
+
+	switch key.KeyType {
+	case "RSA":
+		n, err := decodeInt(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", key.Curve)
+		}
+		x, err := decodeInt(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if key.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", key.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", key.KeyType)
+}
+
+// Identity is what the identity provider asserted about the user in a verified id_token.
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Groups            []string
+	hasGroups         bool
+}
+
+func verifyIDToken(idToken string, nonce string) (Identity, error) {
+
+	var identity Identity
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+		default:
+			return nil, ErrInvalidIDToken
+		}
+		kid, _ := token.Header["kid"].(string)
+		return provider.key(kid)
+	})
+	if err != nil {
+		// Failing to fetch the keys of the provider isn't the fault of the token.
+		var validation *jwt.ValidationError
+		if errors.As(err, &validation) && validation.Errors&jwt.ValidationErrorUnverifiable != 0 &&
+			validation.Inner != nil && !errors.Is(validation.Inner, ErrInvalidIDToken) {
+			return identity, validation.Inner
+		}
+		return identity, ErrInvalidIDToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return identity, ErrInvalidIDToken
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != settings.Issuer {
+		return identity, ErrInvalidIDToken
+	}
+	if !hasAudience(claims["aud"], settings.ClientID) {
+		return identity, ErrInvalidIDToken
+	}
+	if _, ok := claims["exp"]; !ok {
+		return identity, ErrInvalidIDToken
+	}
+	if claimed, _ := claims["nonce"].(string); claimed != nonce {
+		return identity, ErrInvalidIDToken
+	}
+	identity.Subject, _ = claims["sub"].(string)
+	if len(identity.Subject) == 0 {
+		return identity, ErrInvalidIDToken
+	}
+	identity.merge(claims)
+	return identity, nil
+}
+
+func hasAudience(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, audience := range aud {
+			if audience == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// merge takes the profile claims of the user from an id_token or a userinfo response.
+func (identity *Identity) merge(claims map[string]interface{}) {
+
+	if email, ok := claims["email"].(string); ok {
+		identity.Email = email
+		// Some providers send email_verified as a string.
+		switch verified := claims["email_verified"].(type) {
+		case bool:
+			identity.EmailVerified = verified
+		case string:
+			identity.EmailVerified = verified == "true"
+		default:
+			identity.EmailVerified = false
+		}
+	}
+	if username, ok := claims["preferred_username"].(string); ok {
+		identity.PreferredUsername = username
+	}
+	switch groups := claims[settings.GroupsClaim].(type) {
+	case []interface{}:
+		identity.Groups = []string{}
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				identity.Groups = append(identity.Groups, name)
+			}
+		}
+		identity.hasGroups = true
+	case string:
+		identity.Groups = strings.Fields(groups)
+		identity.hasGroups = true
+	}
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func exchange(metadata *discovery, code string, codeVerifier string) (tokenResponse, error) {
+
+	var response tokenResponse
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {settings.RedirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	if len(settings.ClientSecret) == 0 {
+		form.Set("client_id", settings.ClientID)
+	}
+	request, err := http.NewRequest(http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return response, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if len(settings.ClientSecret) > 0 {
+		request.SetBasicAuth(url.QueryEscape(settings.ClientID), url.QueryEscape(settings.ClientSecret))
+	}
+	reply, err := httpClient.Do(request)
+	if err != nil {
+		return response, err
+	}
+	defer reply.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(reply.Body, 1<<20)).Decode(&response); err != nil {
+		return response, err
+	}
+	if reply.StatusCode == http.StatusBadRequest && response.Error == "invalid_grant" {
+		return response, ErrInvalidCode
+	}
+	if reply.StatusCode != http.StatusOK {
+		return response, fmt.Errorf("token endpoint returned %s: %s %s", reply.Status, response.Error, response.ErrorDescription)
+	}
+	if len(response.IDToken) == 0 {
+		return response, ErrInvalidIDToken
+	}
+	return response, nil
+}
+
+// userInfo fills in claims the provider leaves out of id_tokens, which some do for groups.
+func userInfo(metadata *discovery, accessToken string, identity *Identity) error {
+
+	if len(metadata.UserInfoEndpoint) == 0 || len(accessToken) == 0 {
+		return nil
+	}
+	request, err := http.NewRequest(http.MethodGet, metadata.UserInfoEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	request.Header.Set("Accept", "application/json")
+	reply, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer reply.Body.Close()
+	if reply.StatusCode != http.StatusOK {
+		return fmt.Errorf("userinfo endpoint returned %s", reply.Status)
+	}
+	var claims map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(reply.Body, 1<<20)).Decode(&claims); err != nil {
+		return err
+	}
+	// The response must be about the subject of the id_token, or it can't be trusted.
+	if claims["sub"] != identity.Subject {
+		return ErrInvalidIDToken
+	}
+	identity.merge(claims)
+	return nil
+}
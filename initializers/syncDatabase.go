@@ -4,15 +4,43 @@ import (
 	"fmt"
 
 	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
 )
 
 func SyncDatabase() {
+	if err := SetupJoinTables(); err != nil {
+		panic(fmt.Sprintf("Couldn't setup join tables: %s", err))
+	}
 	if err := DB.AutoMigrate(&models.User{}); err != nil {
 		panic(fmt.Sprintf("Couldn't sync users table: %s", err))
 	}
 	if err := DB.AutoMigrate(&models.VerifyEmail{}); err != nil {
 		panic(fmt.Sprintf("Couldn't sync verify_emails table: %s", err))
 	}
+	if err := DB.AutoMigrate(&models.LoginThrottle{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync login_throttles table: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.PasswordReset{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync password_resets table: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.Session{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync sessions table: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.RefreshToken{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync refresh_tokens table: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.RevokedToken{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync revoked_tokens table: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.TwoFactor{}, &models.RecoveryCode{}, &models.LoginChallenge{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync two_factors, recovery_codes and login_challenges tables: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.OutboundEmail{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync outbound_emails table: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.SigningKey{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync signing_keys table: %s", err))
+	}
 	if err := DB.AutoMigrate(&models.Role{}); err != nil {
 		panic(fmt.Sprintf("Couldn't sync roles table: %s", err))
 	}
@@ -22,5 +50,79 @@ func SyncDatabase() {
 	if err := DB.AutoMigrate(&models.Task{}); err != nil {
 		panic(fmt.Sprintf("Couldn't sync tasks table: %s", err))
 	}
+	if err := DB.AutoMigrate(&models.TaskState{}, &models.TaskTransition{}, &models.TaskStatusChange{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync task_states, task_transitions and task_status_changes tables: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.TaskReminder{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync task_reminders table: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.TaskComment{}, &models.TaskCommentMention{}, &models.TaskActivity{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync task_comments, task_comment_mentions and task_activities tables: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.UserRole{}, &models.UserGroup{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync user_roles and user_groups tables: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.RolePermission{}, &models.GroupPermission{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync role_permissions and group_permissions tables: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.ExpiredMembership{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync expired_memberships table: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.APIToken{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync api_tokens table: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.OAuthClient{}, &models.OAuthAuthorizationCode{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync oauth_clients and oauth_authorization_codes tables: %s", err))
+	}
+	if err := DB.AutoMigrate(&models.FederatedIdentity{}, &models.FederatedLoginState{}, &models.GroupMapping{}); err != nil {
+		panic(fmt.Sprintf("Couldn't sync federated_identities, federated_login_states and group_mappings tables: %s", err))
+	}
+	if err := migrateUserRoles(); err != nil {
+		panic(fmt.Sprintf("Couldn't migrate user roles: %s", err))
+	}
 	fmt.Println("✅ Synced Database")
 }
+
+// SetupJoinTables swaps the generated membership join tables for models carrying a validity window,
+// and the permission join tables for models carrying an allow/deny effect.
+func SetupJoinTables() error {
+
+	if err := DB.SetupJoinTable(&models.User{}, "Roles", &models.UserRole{}); err != nil {
+		return err
+	}
+	if err := DB.SetupJoinTable(&models.Role{}, "Users", &models.UserRole{}); err != nil {
+		return err
+	}
+	if err := DB.SetupJoinTable(&models.User{}, "Groups", &models.UserGroup{}); err != nil {
+		return err
+	}
+	if err := DB.SetupJoinTable(&models.Group{}, "Users", &models.UserGroup{}); err != nil {
+		return err
+	}
+	if err := DB.SetupJoinTable(&models.Role{}, "Permissions", &models.RolePermission{}); err != nil {
+		return err
+	}
+	if err := DB.SetupJoinTable(&models.Permission{}, "Roles", &models.RolePermission{}); err != nil {
+		return err
+	}
+	if err := DB.SetupJoinTable(&models.Group{}, "Permissions", &models.GroupPermission{}); err != nil {
+		return err
+	}
+	return DB.SetupJoinTable(&models.Permission{}, "Groups", &models.GroupPermission{})
+}
+
+// migrateUserRoles moves the single users.role column into the user_roles join table.
+func migrateUserRoles() error {
+
+	if !DB.Migrator().HasColumn(&models.User{}, "role") {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO user_roles (user_id, user_username, role_id, role_name, created_at)
+			SELECT users.id, users.username, roles.id, roles.name, NOW() FROM users JOIN roles ON roles.name = users.role
+			ON CONFLICT DO NOTHING`).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.User{}, "role")
+	})
+}
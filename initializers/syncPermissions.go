@@ -7,30 +7,55 @@ import (
 	"github.com/guptaharsh13/balkanid-task/models"
 )
 
-var PermissibleTables = []string{"users", "tasks", "roles", "permissions"}
+var PermissibleTables = []string{"users", "tasks", "roles", "permissions", "groups"}
 var Operations = []string{"CREATE", "READ", "UPDATE", "DELETE"}
 
+// SyncPermissions reconciles the built-in permissions with PermissibleTables and Operations.
+// Custom permissions are left untouched.
 func SyncPermissions() {
 
-	var permissions []models.Permission
-
+	builtIn := map[string]models.Permission{}
 	for _, table := range PermissibleTables {
 		for _, operation := range Operations {
-
 			name := fmt.Sprintf("%s_%s", strings.ToLower(operation), table)
-			if result := DB.Take(&models.Permission{}, "name = ?", name); result.RowsAffected > 0 {
-				continue
-			}
-			permission := models.Permission{
+			builtIn[name] = models.Permission{
 				Name:        name,
 				Description: fmt.Sprintf("This permission allows any user to perform %s operation on the %s table.", string(operation), table),
 				Table:       table,
 				Operation:   operation,
+				IsBuiltIn:   true,
 			}
-			permissions = append(permissions, permission)
 		}
 	}
 
+	var existing []models.Permission
+	if result := DB.Find(&existing); result.Error != nil {
+		panic(fmt.Sprintf("Couldn't fetch permissions: %s", result.Error))
+	}
+	for _, permission := range existing {
+		expected, ok := builtIn[permission.Name]
+		if !ok {
+			if permission.IsBuiltIn {
+				if result := DB.Unscoped().Select("Roles", "Groups").Delete(&permission); result.Error != nil {
+					panic(fmt.Sprintf("Couldn't remove stale permission %s: %s", permission.Name, result.Error))
+				}
+			}
+			continue
+		}
+		delete(builtIn, permission.Name)
+		if permission.IsBuiltIn && permission.Table == expected.Table && permission.Operation == expected.Operation {
+			continue
+		}
+		updates := map[string]interface{}{"table": expected.Table, "operation": expected.Operation, "is_built_in": true}
+		if result := DB.Model(&permission).Updates(updates); result.Error != nil {
+			panic(fmt.Sprintf("Couldn't update permission %s: %s", permission.Name, result.Error))
+		}
+	}
+
+	var permissions []models.Permission
+	for _, permission := range builtIn {
+		permissions = append(permissions, permission)
+	}
 	if len(permissions) != 0 {
 		if result := DB.Create(&permissions); result.Error != nil {
 			panic(fmt.Sprintf("Couldn't create permissions: %s", result.Error))
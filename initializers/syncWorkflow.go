@@ -0,0 +1,54 @@
+package initializers
+
+import (
+	"fmt"
+
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+)
+
+// SyncWorkflow seeds the default task workflow when none is configured and puts tasks without
+// a status into the initial state.
+func SyncWorkflow() {
+
+	var count int64
+	if result := DB.Model(&models.TaskState{}).Count(&count); result.Error != nil {
+		panic(fmt.Sprintf("Couldn't count task states: %s", result.Error))
+	}
+	if count == 0 {
+		states := []models.TaskState{
+			{Name: "open", Description: "Not started yet", IsInitial: true},
+			{Name: "in_progress", Description: "Being worked on"},
+			{Name: "done", Description: "Finished", IsFinal: true},
+			{Name: "cancelled", Description: "Won't be done", IsFinal: true},
+		}
+		transitions := []models.TaskTransition{
+			{From: "open", To: "in_progress"},
+			{From: "in_progress", To: "open"},
+			{From: "in_progress", To: "done"},
+			{From: "open", To: "cancelled"},
+			{From: "in_progress", To: "cancelled"},
+			{From: "done", To: "open"},
+			{From: "cancelled", To: "open"},
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&states).Error; err != nil {
+				return err
+			}
+			return tx.Create(&transitions).Error
+		})
+		if err != nil {
+			panic(fmt.Sprintf("Couldn't seed task workflow: %s", err))
+		}
+	}
+
+	var initial models.TaskState
+	if result := DB.Limit(1).Find(&initial, "is_initial = ?", true); result.Error != nil {
+		panic(fmt.Sprintf("Couldn't fetch initial task state: %s", result.Error))
+	} else if result.RowsAffected > 0 {
+		if result := DB.Model(&models.Task{}).Where("status IS NULL OR status = ''").Update("status", initial.Name); result.Error != nil {
+			panic(fmt.Sprintf("Couldn't set status of tasks: %s", result.Error))
+		}
+	}
+	fmt.Println("✅ Workflow Synced")
+}
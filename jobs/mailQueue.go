@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/mailer"
+)
+
+// StartMailQueue sends queued emails every interval, and right away when one is queued.
+func StartMailQueue(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			sent, err := mailer.DeliverDue(time.Now())
+			if err != nil {
+				fmt.Printf("Couldn't deliver queued emails: %s\n", err.Error())
+			} else if sent > 0 {
+				fmt.Printf("📨 Sent %d emails\n", sent)
+			}
+			select {
+			case <-ticker.C:
+			case <-mailer.Wake():
+			}
+		}
+	}()
+	fmt.Println("✅ Mail Queue Started")
+}
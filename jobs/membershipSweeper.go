@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func StartMembershipSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			removed, err := SweepExpiredMemberships(time.Now())
+			if err != nil {
+				fmt.Printf("Couldn't sweep expired memberships: %s\n", err.Error())
+			} else if removed > 0 {
+				fmt.Printf("🧹 Removed %d expired memberships\n", removed)
+			}
+			<-ticker.C
+		}
+	}()
+	fmt.Println("✅ Membership Sweeper Started")
+}
+
+// SweepExpiredMemberships deletes role and group memberships whose validity window ended before now and
+// records each one as a models.ExpiredMembership. Locked rows are skipped so replicas don't sweep the same row.
+func SweepExpiredMemberships(now time.Time) (int, error) {
+
+	removed := 0
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+
+		var userRoles []models.UserRole
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Find(&userRoles, "valid_until <= ?", now); result.Error != nil {
+			return result.Error
+		}
+		var userGroups []models.UserGroup
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Find(&userGroups, "valid_until <= ?", now); result.Error != nil {
+			return result.Error
+		}
+
+		expired := []models.ExpiredMembership{}
+		for _, userRole := range userRoles {
+			if result := tx.Delete(&userRole); result.Error != nil {
+				return result.Error
+			}
+			expired = append(expired, models.ExpiredMembership{
+				Kind:       "role",
+				Username:   userRole.UserUsername,
+				Name:       userRole.RoleName,
+				ValidFrom:  userRole.ValidFrom,
+				ValidUntil: *userRole.ValidUntil,
+			})
+		}
+		for _, userGroup := range userGroups {
+			if result := tx.Delete(&userGroup); result.Error != nil {
+				return result.Error
+			}
+			expired = append(expired, models.ExpiredMembership{
+				Kind:       "group",
+				Username:   userGroup.UserUsername,
+				Name:       userGroup.GroupName,
+				ValidFrom:  userGroup.ValidFrom,
+				ValidUntil: *userGroup.ValidUntil,
+			})
+		}
+		if len(expired) == 0 {
+			return nil
+		}
+		removed = len(expired)
+		return tx.Create(&expired).Error
+	})
+	return removed, err
+}
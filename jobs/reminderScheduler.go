@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/reminders"
+)
+
+// StartReminderScheduler reminds asignees of due and overdue tasks every interval.
+func StartReminderScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			sent, err := reminders.Run(time.Now())
+			if err != nil {
+				fmt.Printf("Couldn't send task reminders: %s\n", err.Error())
+			} else if sent > 0 {
+				fmt.Printf("🔔 Sent %d task reminders\n", sent)
+			}
+			<-ticker.C
+		}
+	}()
+	fmt.Println("✅ Reminder Scheduler Started")
+}
@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/federation"
+	"github.com/guptaharsh13/balkanid-task/lockout"
+	"github.com/guptaharsh13/balkanid-task/oauth"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/guptaharsh13/balkanid-task/twofactor"
+)
+
+func StartTokenSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			removed, err := tokens.PurgeExpired(time.Now())
+			if err != nil {
+				fmt.Printf("Couldn't purge expired tokens: %s\n", err.Error())
+			} else if removed > 0 {
+				fmt.Printf("🧹 Removed %d expired tokens\n", removed)
+			}
+			removed, err = twofactor.PurgeExpiredChallenges(time.Now())
+			if err != nil {
+				fmt.Printf("Couldn't purge expired login challenges: %s\n", err.Error())
+			} else if removed > 0 {
+				fmt.Printf("🧹 Removed %d expired login challenges\n", removed)
+			}
+			removed, err = lockout.PurgeStale(time.Now())
+			if err != nil {
+				fmt.Printf("Couldn't purge stale login throttles: %s\n", err.Error())
+			} else if removed > 0 {
+				fmt.Printf("🧹 Removed %d stale login throttles\n", removed)
+			}
+			removed, err = oauth.PurgeExpiredCodes(time.Now())
+			if err != nil {
+				fmt.Printf("Couldn't purge expired authorization codes: %s\n", err.Error())
+			} else if removed > 0 {
+				fmt.Printf("🧹 Removed %d expired authorization codes\n", removed)
+			}
+			removed, err = federation.PurgeExpiredStates(time.Now())
+			if err != nil {
+				fmt.Printf("Couldn't purge expired federated logins: %s\n", err.Error())
+			} else if removed > 0 {
+				fmt.Printf("🧹 Removed %d expired federated logins\n", removed)
+			}
+			<-ticker.C
+		}
+	}()
+	fmt.Println("✅ Token Sweeper Started")
+}
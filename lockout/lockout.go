@@ -0,0 +1,201 @@
+package lockout
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	maxAccountFailures uint = 5
+	maxIPFailures      uint = 20
+	lockoutDuration         = 15 * time.Minute
+	failureWindow           = 15 * time.Minute
+)
+
+// freeFailures is how many failures in a row are let through before delays kick in.
+const freeFailures = 2
+
+const maxDelay = 30 * time.Second
+
+func Configure(accountFailures uint, ipFailures uint, lockout time.Duration, window time.Duration) {
+	maxAccountFailures = accountFailures
+	maxIPFailures = ipFailures
+	lockoutDuration = lockout
+	failureWindow = window
+}
+
+// Subject normalizes the identifier a login was attempted with, so "Bob" and "bob" share a counter.
+func Subject(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// delay is how long to wait after the given number of failures in a row: nothing for the first few,
+// then doubling from a second up to maxDelay.
+func delay(failures uint) time.Duration {
+	if failures <= freeFailures {
+		return 0
+	}
+	wait := time.Second << (failures - freeFailures - 1)
+	if wait > maxDelay || wait <= 0 {
+		return maxDelay
+	}
+	return wait
+}
+
+func retryAfter(throttle models.LoginThrottle, now time.Time) time.Duration {
+
+	var wait time.Duration
+	if !throttle.LastFailureAt.Add(failureWindow).Before(now) {
+		wait = throttle.LastFailureAt.Add(delay(throttle.Failures)).Sub(now)
+	}
+	if throttle.LockedUntil != nil {
+		if locked := throttle.LockedUntil.Sub(now); locked > wait {
+			wait = locked
+		}
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Check returns how long the client has to wait before it may try to log in to account again.
+// A zero duration means it may try now.
+func Check(account string, ip string) (time.Duration, error) {
+
+	var throttles []models.LoginThrottle
+	result := initializers.DB.Where("(scope = ? AND subject = ?) OR (scope = ? AND subject = ?)",
+		models.ThrottleAccount, account, models.ThrottleIP, ip).Find(&throttles)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	now := time.Now()
+	var wait time.Duration
+	for _, throttle := range throttles {
+		if after := retryAfter(throttle, now); after > wait {
+			wait = after
+		}
+	}
+	return wait, nil
+}
+
+var errRefused = errors.New("attempt refused")
+
+// Attempt counts a login attempt against the account and the client IP before the credentials are checked,
+// so a burst of parallel attempts can't get past the limits together. Attempts are counted as failures
+// until RecordSuccess says otherwise. When either may not try now, nothing is counted and Attempt returns
+// how long the client has to wait.
+func Attempt(account string, ip string) (time.Duration, error) {
+
+	now := time.Now()
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := claim(tx, models.ThrottleAccount, account, maxAccountFailures, now); err != nil {
+			return err
+		}
+		return claim(tx, models.ThrottleIP, ip, maxIPFailures, now)
+	})
+	if err == nil {
+		return 0, nil
+	}
+	if !errors.Is(err, errRefused) {
+		return 0, err
+	}
+	wait, err := Check(account, ip)
+	if err != nil {
+		return 0, err
+	}
+	// Attempts under way can fill up the limit before any of them failed.
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait, nil
+}
+
+// claim counts an attempt against subject in one statement, unless it's locked, has to wait out the delay
+// of its last attempt or has used up its limit. Counting restarts once the failure window passed.
+func claim(tx *gorm.DB, scope string, subject string, limit uint, now time.Time) error {
+
+	if result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.LoginThrottle{Scope: scope, Subject: subject}); result.Error != nil {
+		return result.Error
+	}
+	var counted []uint
+	result := tx.Raw(`UPDATE login_throttles SET
+			failures = CASE WHEN last_failure_at < @window_start THEN 1 ELSE failures + 1 END,
+			last_failure_at = @now, locked_until = NULL, updated_at = @now
+		WHERE scope = @scope AND subject = @subject
+			AND (locked_until IS NULL OR locked_until <= @now)
+			AND (last_failure_at < @window_start OR (
+				(failures < @limit OR locked_until IS NOT NULL)
+				AND (failures <= @free OR last_failure_at + LEAST(@max_delay, power(2, failures - @free - 1)) * interval '1 second' <= @now)))
+		RETURNING failures`,
+		map[string]interface{}{
+			"scope":        scope,
+			"subject":      subject,
+			"limit":        limit,
+			"free":         freeFailures,
+			"max_delay":    int(maxDelay / time.Second),
+			"now":          now,
+			"window_start": now.Add(-failureWindow),
+		}).Scan(&counted)
+	if result.Error != nil {
+		return result.Error
+	}
+	if len(counted) == 0 {
+		return errRefused
+	}
+	return nil
+}
+
+// RecordFailure reports that an attempt failed, locking the account or the client IP once its attempts
+// reached the limit.
+func RecordFailure(account string, ip string) error {
+
+	lockedUntil := time.Now().Add(lockoutDuration)
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.LoginThrottle{}).Where("scope = ? AND subject = ? AND failures >= ?", models.ThrottleAccount, account, maxAccountFailures).
+			Update("locked_until", lockedUntil).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.LoginThrottle{}).Where("scope = ? AND subject = ? AND failures >= ?", models.ThrottleIP, ip, maxIPFailures).
+			Update("locked_until", lockedUntil).Error
+	})
+}
+
+// RecordSuccess reports that an attempt succeeded, clearing the failures of the account. The IP only gets
+// the attempt back, so one valid account can't be used to reset the counter of an address guessing others.
+func RecordSuccess(account string, ip string) error {
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.LoginThrottle{}, "scope = ? AND subject = ?", models.ThrottleAccount, account).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.LoginThrottle{}).Where("scope = ? AND subject = ? AND failures > 0", models.ThrottleIP, ip).
+			Update("failures", gorm.Expr("failures - 1")).Error
+	})
+}
+
+// Locked returns the accounts and addresses locked at now.
+func Locked(now time.Time) ([]models.LoginThrottle, error) {
+	var throttles []models.LoginThrottle
+	result := initializers.DB.Order("locked_until DESC").Find(&throttles, "locked_until > ?", now)
+	return throttles, result.Error
+}
+
+// Unlock clears the failures and the lockout of an account.
+func Unlock(account string) (bool, error) {
+	result := initializers.DB.Delete(&models.LoginThrottle{}, "scope = ? AND subject = ?", models.ThrottleAccount, Subject(account))
+	return result.RowsAffected > 0, result.Error
+}
+
+// PurgeStale deletes counters that are neither locked nor inside the failure window at now.
+func PurgeStale(now time.Time) (int64, error) {
+	result := initializers.DB.Delete(&models.LoginThrottle{},
+		"last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-failureWindow), now)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,172 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a rendered email.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Backend delivers messages. An error means the message should be tried again later.
+type Backend interface {
+	Send(message Message) error
+}
+
+// headerValue keeps header values on one line, so a value can't inject headers of its own.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// Encode renders message as a multipart/alternative MIME message.
+func Encode(message Message) ([]byte, error) {
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		if len(part.content) == 0 {
+			continue
+		}
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err := encoder.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if from, err := mail.ParseAddress(message.From); err == nil {
+		if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+			domain = from.Address[at+1:]
+		}
+	}
+	var encoded bytes.Buffer
+	fmt.Fprintf(&encoded, "From: %s\r\n", headerValue(message.From))
+	fmt.Fprintf(&encoded, "To: %s\r\n", headerValue(message.To))
+	fmt.Fprintf(&encoded, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(message.Subject)))
+	fmt.Fprintf(&encoded, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&encoded, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	fmt.Fprintf(&encoded, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&encoded, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	encoded.Write(body.Bytes())
+	return encoded.Bytes(), nil
+}
+
+// SMTPBackend sends through an SMTP server, upgrading to TLS with STARTTLS when the server offers it.
+type SMTPBackend struct {
+	Host     string
+	Port     uint
+	Username string
+	Password string
+}
+
+func (backend *SMTPBackend) Send(message Message) error {
+
+	from, err := mail.ParseAddress(message.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return err
+	}
+	encoded, err := Encode(message)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if len(backend.Username) > 0 {
+		auth = smtp.PlainAuth("", backend.Username, backend.Password, backend.Host)
+	}
+	address := fmt.Sprintf("%s:%d", backend.Host, backend.Port)
+	return smtp.SendMail(address, auth, from.Address, []string{to.Address}, encoded)
+}
+
+// FileBackend writes every message to an .eml file in Dir, for development.
+type FileBackend struct {
+	Dir string
+}
+
+func (backend *FileBackend) Send(message Message) error {
+
+	encoded, err := Encode(message)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backend.Dir, 0o700); err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(backend.Dir, name), encoded, 0o600)
+}
+
+// MemoryBackend keeps sent messages in memory, for tests.
+type MemoryBackend struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (backend *MemoryBackend) Send(message Message) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	backend.messages = append(backend.messages, message)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (backend *MemoryBackend) Messages() []Message {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	return append([]Message(nil), backend.messages...)
+}
+
+func (backend *MemoryBackend) Reset() {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	backend.messages = nil
+}
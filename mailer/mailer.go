@@ -0,0 +1,218 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/config"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+)
+
+const (
+	TemplateVerifyEmail    = "verify_email"
+	TemplatePasswordReset  = "password_reset"
+	TemplateTaskReminder   = "task_reminder"
+	TemplateCommentMention = "comment_mention"
+)
+
+const (
+	// claimLease is how long a replica has to send a message it picked from the queue before another may.
+	claimLease  = 5 * time.Minute
+	maxBackoff  = time.Hour
+	batchSize   = 50
+	baseBackoff = 30 * time.Second
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFiles, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/*.html"))
+)
+
+var (
+	backend     Backend = &MemoryBackend{}
+	from                = "balkanid-task <no-reply@localhost>"
+	maxAttempts uint    = 10
+	appURL              = "http://localhost:3000"
+	resetURL            = "http://localhost:3000/reset-password"
+	wake                = make(chan struct{}, 1)
+	delivering  sync.Mutex
+)
+
+// Configure picks the backend emails are sent with.
+func Configure(mail config.MailConfig) error {
+
+	switch mail.Backend {
+	case "smtp":
+		backend = &SMTPBackend{Host: mail.SMTP.Host, Port: mail.SMTP.Port, Username: mail.SMTP.Username, Password: mail.SMTP.Password}
+	case "file":
+		backend = &FileBackend{Dir: mail.Dir}
+	case "memory":
+		backend = &MemoryBackend{}
+	default:
+		return fmt.Errorf("unsupported mail backend %s", mail.Backend)
+	}
+	from = mail.From
+	maxAttempts = mail.MaxAttempts
+	appURL = strings.TrimSuffix(mail.AppURL, "/")
+	resetURL = mail.ResetURL
+	return nil
+}
+
+// SetBackend swaps the backend, for tests that want to look at what was sent.
+func SetBackend(b Backend) {
+	backend = b
+}
+
+func AppURL() string {
+	return appURL
+}
+
+func ResetURL() string {
+	return resetURL
+}
+
+// LinkData is what the verify_email and password_reset templates are rendered with.
+type LinkData struct {
+	Username  string
+	Link      string
+	ExpiresIn string
+}
+
+// FormatDuration spells out d for people, in whole hours or minutes.
+func FormatDuration(d time.Duration) string {
+	unit, count := "minute", int(d.Round(time.Minute)/time.Minute)
+	if d >= time.Hour && d%time.Hour == 0 {
+		unit, count = "hour", int(d/time.Hour)
+	}
+	if count == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", count, unit)
+}
+
+// Render fills in the subject, text and HTML bodies of template name.
+func Render(name string, data interface{}) (Message, error) {
+
+	var message Message
+	var subject, text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return message, err
+	}
+	if err := textTemplates.ExecuteTemplate(&text, name+".text", data); err != nil {
+		return message, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return message, err
+	}
+	message.Subject = strings.TrimSpace(subject.String())
+	message.Text = text.String()
+	message.HTML = html.String()
+	return message, nil
+}
+
+// Enqueue renders template name for to and queues it. The mail queue job sends it shortly after,
+// and keeps retrying with backoff while the backend fails.
+func Enqueue(to string, name string, data interface{}) error {
+
+	message, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	email := models.OutboundEmail{
+		To:            to,
+		Subject:       message.Subject,
+		Text:          message.Text,
+		HTML:          message.HTML,
+		NextAttemptAt: time.Now(),
+	}
+	if result := initializers.DB.Create(&email); result.Error != nil {
+		return result.Error
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Wake signals that a message was queued, so the queue needn't wait for its next tick.
+func Wake() <-chan struct{} {
+	return wake
+}
+
+func backoff(attempts uint) time.Duration {
+	delay := baseBackoff
+	for i := uint(1); i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
+
+// DeliverDue sends the queued messages that are due. Sent messages are deleted, failed ones are tried again
+// later and given up on after the configured number of attempts. It returns how many were sent.
+func DeliverDue(now time.Time) (int, error) {
+
+	delivering.Lock()
+	defer delivering.Unlock()
+
+	var due []models.OutboundEmail
+	result := initializers.DB.Where("next_attempt_at <= ? AND failed_at IS NULL", now).Order("next_attempt_at").Limit(batchSize).Find(&due)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	sent := 0
+	for _, email := range due {
+		// Claiming by moving next_attempt_at keeps other replicas from sending the same message.
+		claim := initializers.DB.Model(&models.OutboundEmail{}).
+			Where("id = ? AND next_attempt_at = ?", email.ID, email.NextAttemptAt).
+			Update("next_attempt_at", now.Add(claimLease))
+		if claim.Error != nil {
+			return sent, claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		err := backend.Send(Message{From: from, To: email.To, Subject: email.Subject, Text: email.Text, HTML: email.HTML})
+		if err == nil {
+			if result := initializers.DB.Delete(&email); result.Error != nil {
+				return sent, result.Error
+			}
+			sent++
+			continue
+		}
+
+		attempts := email.Attempts + 1
+		updates := map[string]interface{}{
+			"attempts":        attempts,
+			"last_error":      err.Error(),
+			"next_attempt_at": now.Add(backoff(attempts)),
+		}
+		if attempts >= maxAttempts {
+			// The row stays for diagnosis, without the body and the links in it.
+			updates["failed_at"] = now
+			updates["text"] = ""
+			updates["html"] = ""
+			fmt.Printf("Couldn't send email %d to %s, giving up: %s\n", email.ID, email.To, err.Error())
+		} else {
+			fmt.Printf("Couldn't send email %d to %s, retrying: %s\n", email.ID, email.To, err.Error())
+		}
+		if result := initializers.DB.Model(&email).Updates(updates); result.Error != nil {
+			return sent, result.Error
+		}
+	}
+	return sent, nil
+}
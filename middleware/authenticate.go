@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/guptaharsh13/balkanid-task/utils"
+)
+
+// authenticate verifies the bearer token of the request, a JWT or an API token, and sets the caller on the context.
+// It aborts the request and returns false when the token is missing or rejected.
+func authenticate(c *gin.Context) (models.User, bool) {
+
+	tokenString := c.Request.Header.Get("Authorization")
+	prefix := "Bearer"
+	if strings.HasPrefix(tokenString, prefix) {
+		tokenString = strings.TrimSpace(tokenString[len(prefix):])
+	}
+	if len(tokenString) == 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Authorization token not found"))
+		return models.User{}, false
+	}
+
+	if tokens.IsAPIToken(tokenString) {
+		apiToken, user, err := tokens.AuthenticateAPIToken(tokenString, c.ClientIP())
+		if err != nil {
+			rejectToken(c, err)
+			return user, false
+		}
+		c.Set("is_admin", user.IsAdmin)
+		c.Set("username", user.Username)
+		c.Set("api_token", apiToken)
+		return user, true
+	}
+
+	claims, user, err := tokens.Authenticate(tokenString)
+	if err != nil {
+		rejectToken(c, err)
+		return user, false
+	}
+	c.Set("is_admin", user.IsAdmin)
+	c.Set("username", user.Username)
+	c.Set("claims", claims)
+	return user, true
+}
+
+func rejectToken(c *gin.Context, err error) {
+	if !tokens.Rejected(err) {
+		fmt.Printf("Couldn't check token: %s", err.Error())
+		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, utils.UnauthorizedResponse(tokens.Message(err)))
+}
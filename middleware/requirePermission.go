@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
+	"github.com/guptaharsh13/balkanid-task/utils"
+)
+
+// RequirePermission must run after RequireAuth. Admins are always let through,
+// within the permissions of their API token.
+func RequirePermission(table string, operation string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		username, ok := c.Get("username")
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.UnauthorizedResponse("Unauthorized"))
+			return
+		}
+		if !ScopeAllows(c, table, operation) {
+			rejectScope(c, table, operation)
+			return
+		}
+		if isAdmin, ok := c.Get("is_admin"); ok && isAdmin.(bool) {
+			c.Next()
+			return
+		}
+
+		allowed, err := authz.HasPermission(username.(string), table, operation)
+		if err != nil {
+			fmt.Printf("Couldn't resolve permissions for %s: %s", username, err.Error())
+			c.AbortWithStatusJSON(http.StatusInternalServerError, utils.InternalServerErrorResponse())
+			return
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, utils.ForbiddenResponse(fmt.Sprintf("Missing permission %s", authz.PermissionName(table, operation))))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/utils"
+)
+
+// ScopeAllows reports whether the credential of the request may be used for operation on table.
+// Logins may do whatever their user may, API tokens only what they were created with.
+func ScopeAllows(c *gin.Context, table string, operation string) bool {
+
+	value, ok := c.Get("api_token")
+	if !ok {
+		return true
+	}
+	for _, permission := range value.(models.APIToken).Permissions {
+		if permission.Table == table && permission.Operation == operation {
+			return true
+		}
+	}
+	return false
+}
+
+func rejectScope(c *gin.Context, table string, operation string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, utils.ForbiddenResponse(fmt.Sprintf("API token lacks permission %s", authz.PermissionName(table, operation))))
+}
+
+// RequireScope must run after RequireAuth. It limits API tokens on routes whose handler checks permissions itself.
+func RequireScope(table string, operation string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ScopeAllows(c, table, operation) {
+			rejectScope(c, table, operation)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession is RequireAuth for routes that manage the account itself, which API tokens can't be used for.
+func RequireSession(c *gin.Context) {
+
+	if _, ok := authenticate(c); !ok {
+		return
+	}
+	if _, ok := c.Get("api_token"); ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, utils.ForbiddenResponse("API tokens can't be used here"))
+		return
+	}
+	c.Next()
+}
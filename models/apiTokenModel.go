@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// APIToken is a long-lived credential for scripts and service accounts. It's stored hashed and can only
+// be used for the permissions it was created with, as far as its owner still holds them.
+type APIToken struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"not null" json:"name"`
+	UserID      string       `gorm:"index;not null" json:"user_id"`
+	User        User         `gorm:"references:Username;constraint:OnDelete:CASCADE" json:"-"`
+	TokenHash   string       `gorm:"uniqueIndex;not null" json:"-"`
+	Prefix      string       `gorm:"not null" json:"prefix"`
+	Permissions []Permission `gorm:"many2many:api_token_permissions;foreignKey:ID;joinForeignKey:APITokenID;references:ID;joinReferences:PermissionID;constraint:OnDelete:CASCADE" json:"permissions"`
+	ExpiresAt   *time.Time   `json:"expires_at"`
+	LastUsedAt  *time.Time   `json:"last_used_at"`
+	LastUsedIP  string       `json:"last_used_ip"`
+	RevokedAt   *time.Time   `json:"revoked_at"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExpiredMembership records a role or group membership removed by the sweeper once its validity window ended.
+type ExpiredMembership struct {
+	gorm.Model
+	Kind       string     `gorm:"not null" json:"kind"`
+	Username   string     `gorm:"not null" json:"username"`
+	Name       string     `gorm:"not null" json:"name"`
+	ValidFrom  *time.Time `json:"valid_from"`
+	ValidUntil time.Time  `gorm:"not null" json:"valid_until"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+const (
+	MappingGroup = "group"
+	MappingRole  = "role"
+
+	// MembershipFederated marks memberships granted from the claims of the identity provider. They are
+	// added and removed on every federated login, unlike memberships granted by admins.
+	MembershipFederated = "federation"
+)
+
+// FederatedIdentity links the subject of the external identity provider to a user.
+type FederatedIdentity struct {
+	Issuer      string    `gorm:"primaryKey" json:"issuer"`
+	Subject     string    `gorm:"primaryKey" json:"subject"`
+	UserID      string    `gorm:"index;not null" json:"user_id"`
+	User        User      `gorm:"references:Username;constraint:OnDelete:CASCADE" json:"-"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// FederatedLoginState is a federated login in progress, kept until the identity provider redirects back.
+type FederatedLoginState struct {
+	StateHash    string    `gorm:"primaryKey" json:"-"`
+	Nonce        string    `gorm:"not null" json:"-"`
+	CodeVerifier string    `gorm:"not null" json:"-"`
+	ExpiresAt    time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// GroupMapping grants a group or role to users whose identity provider groups match Claim, a path.Match pattern.
+type GroupMapping struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Claim     string    `gorm:"uniqueIndex:idx_group_mapping;not null" json:"claim"`
+	Kind      string    `gorm:"uniqueIndex:idx_group_mapping;not null" json:"kind"`
+	Name      string    `gorm:"uniqueIndex:idx_group_mapping;not null" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
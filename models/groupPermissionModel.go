@@ -0,0 +1,10 @@
+package models
+
+type GroupPermission struct {
+	GroupID        uint   `gorm:"primaryKey" json:"group_id"`
+	GroupName      string `gorm:"primaryKey" json:"group"`
+	PermissionID   uint   `gorm:"primaryKey" json:"permission_id"`
+	PermissionName string `gorm:"primaryKey" json:"permission"`
+	Effect         string `gorm:"not null;default:allow" json:"effect"`
+	Condition      string `json:"condition"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	ThrottleAccount = "account"
+	ThrottleIP      = "ip"
+)
+
+// LoginThrottle counts the recent failed logins of an account or a client IP. Attempts are counted before
+// they're made and taken back when they succeed, so LastFailureAt is the time of the last attempt. Subject is
+// the username or login identifier for accounts and the address for IPs.
+type LoginThrottle struct {
+	Scope         string     `gorm:"primaryKey" json:"scope"`
+	Subject       string     `gorm:"primaryKey" json:"subject"`
+	Failures      uint       `gorm:"default:0" json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `gorm:"index" json:"locked_until"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// OAuthClient is an application registered to sign users in through the OAuth2 / OpenID Connect provider.
+// Public clients have no secret and rely on PKCE alone.
+type OAuthClient struct {
+	ClientID   string `gorm:"primaryKey" json:"client_id"`
+	Name       string `gorm:"not null" json:"name"`
+	SecretHash string `json:"-"`
+	// RedirectURIs are separated by spaces, like the scope parameter of OAuth2.
+	RedirectURIs string    `gorm:"not null" json:"-"`
+	CreatedBy    string    `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// OAuthAuthorizationCode is a single-use code handed to a client by the authorization endpoint.
+type OAuthAuthorizationCode struct {
+	CodeHash      string      `gorm:"primaryKey" json:"-"`
+	ClientID      string      `gorm:"index;not null" json:"client_id"`
+	Client        OAuthClient `gorm:"references:ClientID;constraint:OnDelete:CASCADE" json:"-"`
+	UserID        string      `gorm:"index;not null" json:"user_id"`
+	User          User        `gorm:"references:Username;constraint:OnDelete:CASCADE" json:"-"`
+	RedirectURI   string      `gorm:"not null" json:"redirect_uri"`
+	Scope         string      `json:"scope"`
+	Nonce         string      `json:"-"`
+	CodeChallenge string      `gorm:"not null" json:"-"`
+	AuthTime      time.Time   `json:"auth_time"`
+	ExpiresAt     time.Time   `gorm:"index;not null" json:"expires_at"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// OutboundEmail is an email waiting in the mail queue. It's deleted once sent, so its body, which
+// can carry links with tokens, doesn't outlive delivery.
+type OutboundEmail struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	To            string     `gorm:"not null" json:"to"`
+	Subject       string     `gorm:"not null" json:"subject"`
+	Text          string     `json:"-"`
+	HTML          string     `json:"-"`
+	Attempts      uint       `gorm:"default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index;not null" json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	FailedAt      *time.Time `gorm:"index" json:"failed_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
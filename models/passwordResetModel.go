@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordReset holds the hash of the latest reset token of a user. Requesting a new one replaces it.
+type PasswordReset struct {
+	gorm.Model
+	UserID     string    `gorm:"uniqueIndex" json:"user_id"`
+	User       User      `gorm:"references:Username;constraint:OnDelete:CASCADE" json:"-"`
+	CodeHash   string    `gorm:"uniqueIndex;not null" json:"-"`
+	Expiration time.Time `gorm:"not null" json:"expiration"`
+	IsUsed     bool      `gorm:"default:false" json:"is_used"`
+}
@@ -10,6 +10,7 @@ type Permission struct {
 	Description string `json:"description"`
 	Table       string `gorm:"not null" json:"table"`
 	Operation   string `gorm:"not null" json:"operation"`
+	IsBuiltIn   bool   `gorm:"default:false" json:"is_built_in"`
 
 	Groups []Group `gorm:"many2many:group_permissions;constraint:OnDelete:SET NULL" json:"groups"`
 	Roles  []Role  `gorm:"many2many:role_permissions;constraint:OnDelete:SET NULL" json:"roles"`
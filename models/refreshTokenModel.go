@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken is stored hashed. Tokens rotated from the same login share a FamilyID, so reusing a rotated
+// token revokes the whole family.
+type RefreshToken struct {
+	gorm.Model
+	UserID    string     `gorm:"index" json:"user_id"`
+	User      User       `gorm:"references:Username;constraint:OnDelete:CASCADE" json:"-"`
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	FamilyID  string     `gorm:"index;not null" json:"family_id"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
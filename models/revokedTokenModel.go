@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// RevokedToken is an access token revoked before it expired, identified by its jti claim.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey" json:"jti"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
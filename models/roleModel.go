@@ -6,7 +6,10 @@ type Role struct {
 	gorm.Model
 	Name        string `gorm:"primaryKey;unique;uniqueIndex;not null" json:"name"`
 	Description string `json:"description"`
+	// RequireTwoFactor makes holders of the role enroll in two-factor authentication before they can log in.
+	RequireTwoFactor bool `gorm:"default:false" json:"require_two_factor"`
 
-	Users       []User       `gorm:"foreignKey:Role;references:Name;constraint:OnDelete:SET NULL" json:"users"`
+	Users       []User       `gorm:"many2many:user_roles;constraint:OnDelete:SET NULL" json:"users"`
 	Permissions []Permission `gorm:"many2many:role_permissions;constraint:OnDelete:SET NULL" json:"permissions"`
+	Parents     []Role       `gorm:"many2many:role_parents;foreignKey:ID;joinForeignKey:RoleID;references:ID;joinReferences:ParentID;constraint:OnDelete:CASCADE" json:"parents"`
 }
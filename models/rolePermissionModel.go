@@ -0,0 +1,15 @@
+package models
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+type RolePermission struct {
+	RoleID         uint   `gorm:"primaryKey" json:"role_id"`
+	RoleName       string `gorm:"primaryKey" json:"role"`
+	PermissionID   uint   `gorm:"primaryKey" json:"permission_id"`
+	PermissionName string `gorm:"primaryKey" json:"permission"`
+	Effect         string `gorm:"not null;default:allow" json:"effect"`
+	Condition      string `json:"condition"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session is one login of a user. Its ID is the family of its refresh tokens and the sid claim of its
+// access tokens, so revoking it ends both.
+type Session struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	UserID     string     `gorm:"index;not null" json:"user_id"`
+	User       User       `gorm:"references:Username;constraint:OnDelete:CASCADE" json:"-"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
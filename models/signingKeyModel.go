@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// SigningKey signs access tokens. The newest key that isn't retired signs; retired keys keep verifying
+// for an overlap window so tokens issued before a rotation stay valid.
+type SigningKey struct {
+	KID        string     `gorm:"primaryKey" json:"kid"`
+	Algorithm  string     `gorm:"not null" json:"algorithm"`
+	PrivateKey string     `gorm:"not null" json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RetiredAt  *time.Time `gorm:"index" json:"retired_at"`
+}
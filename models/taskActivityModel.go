@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+const (
+	ActivityCreated       = "created"
+	ActivityUpdated       = "updated"
+	ActivityAssigned      = "assigned"
+	ActivityUnassigned    = "unassigned"
+	ActivityStatusChanged = "status_changed"
+	ActivityCommented     = "commented"
+)
+
+// TaskActivity is an entry of the activity feed of a task. Subject names the user assigned or unassigned,
+// or the fields updated. Comments and status changes are linked rather than copied.
+type TaskActivity struct {
+	ID             uint              `gorm:"primaryKey" json:"id"`
+	TaskID         uint              `gorm:"index;not null" json:"task_id"`
+	Task           Task              `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Actor          string            `gorm:"not null" json:"actor"`
+	Kind           string            `gorm:"not null" json:"kind"`
+	Subject        string            `json:"subject,omitempty"`
+	CommentID      *uint             `json:"-"`
+	Comment        *TaskComment      `gorm:"constraint:OnDelete:CASCADE" json:"comment,omitempty"`
+	StatusChangeID *uint             `json:"-"`
+	StatusChange   *TaskStatusChange `gorm:"constraint:OnDelete:CASCADE" json:"status_change,omitempty"`
+	CreatedAt      time.Time         `gorm:"index" json:"created_at"`
+}
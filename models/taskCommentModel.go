@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// TaskComment is a comment on a task. Replies point at the comment starting their thread, so threads are
+// one level deep. A comment removed while it has replies stays behind with an empty body to keep its thread.
+type TaskComment struct {
+	ID        uint                 `gorm:"primaryKey" json:"id"`
+	TaskID    uint                 `gorm:"index;not null" json:"task_id"`
+	Task      Task                 `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	ParentID  *uint                `gorm:"index" json:"parent_id"`
+	Author    string               `gorm:"index;not null" json:"author"`
+	Body      string               `gorm:"not null" json:"body"`
+	Mentions  []TaskCommentMention `gorm:"foreignKey:CommentID;constraint:OnDelete:CASCADE" json:"mentions"`
+	Replies   []TaskComment        `gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE" json:"replies,omitempty"`
+	EditedAt  *time.Time           `json:"edited_at"`
+	RemovedAt *time.Time           `json:"removed_at"`
+	CreatedAt time.Time            `gorm:"index" json:"created_at"`
+}
+
+// TaskCommentMention is a user mentioned in a comment with @username.
+type TaskCommentMention struct {
+	CommentID uint   `gorm:"primaryKey" json:"-"`
+	UserID    string `gorm:"primaryKey" json:"user_id"`
+	User      User   `gorm:"references:Username;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -1,11 +1,27 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
 
 type Task struct {
 	gorm.Model
 	Name        string `gorm:"not null" json:"name"`
 	Description string `json:"description"`
 	Creator     string `gorm:"not null" json:"creator"`
-	Asignees    []User `gorm:"many2many:task_asignees;constraint:OnDelete:SET NULL" json:"asignees"`
+	// Status is the name of a TaskState, changed through the transitions of the workflow.
+	Status    string     `gorm:"index" json:"status"`
+	Priority  string     `gorm:"index;not null;default:medium" json:"priority"`
+	StartDate *time.Time `gorm:"index" json:"start_date"`
+	DueDate   *time.Time `gorm:"index" json:"due_date"`
+	Asignees  []User     `gorm:"many2many:task_asignees;constraint:OnDelete:SET NULL" json:"asignees"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+const (
+	ReminderDueSoon = "due_soon"
+	ReminderOverdue = "overdue"
+)
+
+// TaskReminder records a reminder sent to an asignee. Its key includes the due date, so moving the due date
+// gets new reminders, and claiming it by inserting keeps replicas from sending the same reminder twice.
+type TaskReminder struct {
+	TaskID   uint      `gorm:"primaryKey" json:"task_id"`
+	Task     Task      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Username string    `gorm:"primaryKey" json:"username"`
+	Kind     string    `gorm:"primaryKey" json:"kind"`
+	DueDate  time.Time `gorm:"primaryKey" json:"due_date"`
+	SentAt   time.Time `json:"sent_at"`
+}
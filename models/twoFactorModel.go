@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// TwoFactor is the TOTP enrollment of a user. It only guards logins once ConfirmedAt is set.
+type TwoFactor struct {
+	UserID string `gorm:"primaryKey" json:"user_id"`
+	User   User   `gorm:"references:Username;constraint:OnDelete:CASCADE" json:"-"`
+	Secret string `gorm:"not null" json:"-"`
+	// LastUsedStep is the TOTP time step of the last accepted code, so a code can't be replayed.
+	LastUsedStep int64      `gorm:"default:0" json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// RecoveryCode is a hashed one-time code that stands in for a TOTP code when the device is lost.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    string     `gorm:"index;not null" json:"user_id"`
+	User      User       `gorm:"references:Username;constraint:OnDelete:CASCADE" json:"-"`
+	CodeHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// LoginChallenge is handed out by the password step of a login and exchanged for tokens by the second step.
+type LoginChallenge struct {
+	ChallengeHash string    `gorm:"primaryKey" json:"-"`
+	UserID        string    `gorm:"index;not null" json:"user_id"`
+	User          User      `gorm:"references:Username;constraint:OnDelete:CASCADE" json:"-"`
+	Attempts      uint      `gorm:"default:0" json:"attempts"`
+	ExpiresAt     time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type UserGroup struct {
+	UserID       uint       `gorm:"primaryKey" json:"user_id"`
+	UserUsername string     `gorm:"primaryKey" json:"username"`
+	GroupID      uint       `gorm:"primaryKey" json:"group_id"`
+	GroupName    string     `gorm:"primaryKey" json:"group"`
+	ValidFrom    *time.Time `json:"valid_from"`
+	ValidUntil   *time.Time `gorm:"index" json:"valid_until"`
+	// Source is empty for memberships granted by admins and MembershipFederated for ones synced from the identity provider.
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
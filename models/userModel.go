@@ -9,8 +9,13 @@ type User struct {
 	Password string `gorm:"not null" json:"password"`
 	IsActive bool   `gorm:"default:false" json:"is_active"`
 	IsAdmin  bool   `gorm:"default:false" json:"is_admin"`
+	// IsServiceAccount marks non-human users. They can't log in with a password and authenticate with API tokens only.
+	IsServiceAccount bool `gorm:"default:false" json:"is_service_account"`
 
-	Role   string  `gorm:"default:NULL" json:"role"`
+	// TokenVersion is embedded in access tokens; bumping it revokes every token issued before.
+	TokenVersion uint `gorm:"default:0" json:"-"`
+
+	Roles  []Role  `gorm:"many2many:user_roles;constraint:OnDelete:SET NULL" json:"roles"`
 	Groups []Group `gorm:"many2many:user_groups;constraint:OnDelete:SET NULL" json:"groups"`
 
 	CreatedTasks  []Task `gorm:"foreignKey:Creator;references:Username;constraint:OnDelete:SET NULL" json:"created_tasks"`
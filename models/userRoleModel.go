@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type UserRole struct {
+	UserID       uint       `gorm:"primaryKey" json:"user_id"`
+	UserUsername string     `gorm:"primaryKey" json:"username"`
+	RoleID       uint       `gorm:"primaryKey" json:"role_id"`
+	RoleName     string     `gorm:"primaryKey" json:"role"`
+	ValidFrom    *time.Time `json:"valid_from"`
+	ValidUntil   *time.Time `gorm:"index" json:"valid_until"`
+	// Source is empty for memberships granted by admins and MembershipFederated for ones synced from the identity provider.
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// TaskState is a status tasks can be in. New tasks start in the initial state; final states mark finished work.
+type TaskState struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;not null" json:"name"`
+	Description string    `json:"description"`
+	IsInitial   bool      `gorm:"default:false" json:"is_initial"`
+	IsFinal     bool      `gorm:"default:false" json:"is_final"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TaskTransition allows moving a task from one state to another. When Permission is set, only users
+// granted that permission on the task may make the transition.
+type TaskTransition struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	From       string    `gorm:"column:from_state;uniqueIndex:idx_task_transition;not null" json:"from"`
+	FromState  TaskState `gorm:"foreignKey:From;references:Name;constraint:OnDelete:CASCADE,OnUpdate:CASCADE" json:"-"`
+	To         string    `gorm:"column:to_state;uniqueIndex:idx_task_transition;not null" json:"to"`
+	ToState    TaskState `gorm:"foreignKey:To;references:Name;constraint:OnDelete:CASCADE,OnUpdate:CASCADE" json:"-"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TaskStatusChange records a transition made on a task.
+type TaskStatusChange struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TaskID    uint      `gorm:"index;not null" json:"task_id"`
+	Task      Task      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	From      string    `gorm:"column:from_state" json:"from"`
+	To        string    `gorm:"column:to_state;not null" json:"to"`
+	ChangedBy string    `gorm:"not null" json:"changed_by"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+}
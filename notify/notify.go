@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/guptaharsh13/balkanid-task/mailer"
+	"github.com/guptaharsh13/balkanid-task/models"
+)
+
+// Notification tells a user about something that happened. Template names a mailer template,
+// which is rendered with Data.
+type Notification struct {
+	User     models.User
+	Template string
+	Data     interface{}
+}
+
+// Notifier delivers notifications. An error means the notification wasn't accepted and can be tried again.
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+// MailNotifier emails notifications through the mail queue.
+type MailNotifier struct{}
+
+func (MailNotifier) Notify(notification Notification) error {
+	return mailer.Enqueue(notification.User.Email, notification.Template, notification.Data)
+}
+
+// LogNotifier prints notifications, for development.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(notification Notification) error {
+	message, err := mailer.Render(notification.Template, notification.Data)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🔔 %s: %s\n", notification.User.Username, message.Subject)
+	return nil
+}
+
+// MemoryNotifier keeps notifications in memory, for tests.
+type MemoryNotifier struct {
+	mu            sync.Mutex
+	notifications []Notification
+}
+
+func (notifier *MemoryNotifier) Notify(notification Notification) error {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	notifier.notifications = append(notifier.notifications, notification)
+	return nil
+}
+
+func (notifier *MemoryNotifier) Notifications() []Notification {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	return append([]Notification(nil), notifier.notifications...)
+}
+
+var notifier Notifier = LogNotifier{}
+
+// Configure picks how notifications are delivered: mail or log.
+func Configure(kind string) error {
+	switch kind {
+	case "mail":
+		notifier = MailNotifier{}
+	case "log":
+		notifier = LogNotifier{}
+	default:
+		return fmt.Errorf("unsupported notifier %s", kind)
+	}
+	return nil
+}
+
+// SetNotifier swaps the notifier, for tests that want to look at what was sent.
+func SetNotifier(n Notifier) {
+	notifier = n
+}
+
+func Send(notification Notification) error {
+	return notifier.Notify(notification)
+}
@@ -0,0 +1,117 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidClient = errors.New("invalid client")
+
+// Client is the registration of a client as shown to admins.
+type Client struct {
+	models.OAuthClient
+	RedirectURIs []string `json:"redirect_uris"`
+	Public       bool     `json:"public"`
+}
+
+func toClient(client models.OAuthClient) Client {
+	return Client{OAuthClient: client, RedirectURIs: strings.Fields(client.RedirectURIs), Public: len(client.SecretHash) == 0}
+}
+
+// ValidRedirectURI accepts absolute http(s) URIs without a fragment, as RFC 6749 requires.
+func ValidRedirectURI(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "https" || parsed.Scheme == "http") && len(parsed.Host) > 0 && len(parsed.Fragment) == 0
+}
+
+// RegisterClient registers a client. Confidential clients get a secret, which is only returned here.
+func RegisterClient(name string, redirectURIs []string, confidential bool, createdBy string) (Client, string, error) {
+
+	client := models.OAuthClient{
+		ClientID:     uuid.New().String(),
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		CreatedBy:    createdBy,
+	}
+	var secret string
+	if confidential {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return Client{}, "", err
+		}
+		secret = base64.RawURLEncoding.EncodeToString(raw)
+		client.SecretHash = tokens.Hash(secret)
+	}
+	if result := initializers.DB.Create(&client); result.Error != nil {
+		return Client{}, "", result.Error
+	}
+	return toClient(client), secret, nil
+}
+
+func Clients() ([]Client, error) {
+
+	var records []models.OAuthClient
+	if result := initializers.DB.Order("created_at").Find(&records); result.Error != nil {
+		return nil, result.Error
+	}
+	clients := make([]Client, 0, len(records))
+	for _, record := range records {
+		clients = append(clients, toClient(record))
+	}
+	return clients, nil
+}
+
+func FindClient(clientID string) (Client, error) {
+
+	var record models.OAuthClient
+	if result := initializers.DB.Take(&record, "client_id = ?", clientID); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return Client{}, ErrInvalidClient
+		}
+		return Client{}, result.Error
+	}
+	return toClient(record), nil
+}
+
+// DeleteClient removes a client together with its pending authorization codes.
+func DeleteClient(clientID string) (bool, error) {
+	result := initializers.DB.Delete(&models.OAuthClient{}, "client_id = ?", clientID)
+	return result.RowsAffected > 0, result.Error
+}
+
+// AllowsRedirect reports whether uri is registered for the client. URIs are compared exactly.
+func (client Client) AllowsRedirect(uri string) bool {
+	for _, registered := range client.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate checks the secret of a confidential client. Public clients must not send one.
+func (client Client) Authenticate(secret string) error {
+	if client.Public {
+		if len(secret) > 0 {
+			return ErrInvalidClient
+		}
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(tokens.Hash(secret)), []byte(client.SecretHash)) != 1 {
+		return ErrInvalidClient
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"embed"
+	"encoding/base64"
+	"html/template"
+	"io"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var templates = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+// LoginCSRFCookie pairs the login form with the browser it was served to, so another site can't post
+// its own credentials to it and sign the user in as someone else.
+const LoginCSRFCookie = "oauth_login_csrf"
+
+// LoginPage is what the login page shows.
+type LoginPage struct {
+	ReturnTo  string
+	CSRFToken string
+	Username  string
+	Error     string
+}
+
+func RenderLogin(w io.Writer, page LoginPage) error {
+	return templates.ExecuteTemplate(w, "login.html", page)
+}
+
+// NewLoginCSRFToken returns a token for LoginCSRFCookie and the form it guards.
+func NewLoginCSRFToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,335 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/guptaharsh13/balkanid-task/authz"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"gorm.io/gorm"
+)
+
+// Scopes a client may ask for. Unknown scopes are rejected rather than ignored.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopeRoles   = "roles"
+	ScopeGroups  = "groups"
+)
+
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeRoles, ScopeGroups}
+
+var (
+	issuer  = "http://localhost:3000"
+	codeTTL = time.Minute
+)
+
+// Configure sets the issuer URL the provider is reachable at, which every endpoint URL derives from.
+func Configure(issuerURL string, authorizationCodeTTL time.Duration) {
+	issuer = strings.TrimSuffix(issuerURL, "/")
+	codeTTL = authorizationCodeTTL
+}
+
+func Issuer() string {
+	return issuer
+}
+
+// Error is an OAuth2 error response as defined by RFC 6749.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s: %s", err.Code, err.Description)
+}
+
+func oauthError(code string, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
+
+// ParseScope splits a scope parameter and rejects scopes the provider doesn't know.
+func ParseScope(scope string) ([]string, error) {
+
+	scopes := strings.Fields(scope)
+	for _, requested := range scopes {
+		known := false
+		for _, supported := range SupportedScopes {
+			if requested == supported {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, oauthError("invalid_scope", fmt.Sprintf("Unknown scope %s", requested))
+		}
+	}
+	return scopes, nil
+}
+
+func hasScope(scope string, wanted string) bool {
+	for _, granted := range strings.Fields(scope) {
+		if granted == wanted {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizationRequest is what the authorization endpoint accepted from the client and the signed-in user.
+type AuthorizationRequest struct {
+	Client        Client
+	User          models.User
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	AuthTime      time.Time
+}
+
+// IssueCode hands out a single-use authorization code bound to the request and its PKCE challenge.
+func IssueCode(request AuthorizationRequest) (string, error) {
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := base64.RawURLEncoding.EncodeToString(raw)
+	record := models.OAuthAuthorizationCode{
+		CodeHash:      tokens.Hash(code),
+		ClientID:      request.Client.ClientID,
+		UserID:        request.User.Username,
+		RedirectURI:   request.RedirectURI,
+		Scope:         request.Scope,
+		Nonce:         request.Nonce,
+		CodeChallenge: request.CodeChallenge,
+		AuthTime:      request.AuthTime,
+		ExpiresAt:     time.Now().Add(codeTTL),
+	}
+	if result := initializers.DB.Create(&record); result.Error != nil {
+		return "", result.Error
+	}
+	return code, nil
+}
+
+// TokenResponse is the body of a successful token request.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// ExchangeCode redeems an authorization code for an access token, and an id_token when openid was granted.
+// The code is consumed even when the request fails afterwards, so it can't be tried twice.
+func ExchangeCode(client Client, code string, redirectURI string, codeVerifier string, ip string, userAgent string) (TokenResponse, error) {
+
+	var record models.OAuthAuthorizationCode
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Take(&record, "code_hash = ?", tokens.Hash(code))
+		if result.Error != nil {
+			return result.Error
+		}
+		// Only the redemption that deleted the code may use it; a concurrent one finds nothing left to delete.
+		result = tx.Delete(&models.OAuthAuthorizationCode{}, "code_hash = ?", record.CodeHash)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return TokenResponse{}, oauthError("invalid_grant", "Unknown or used authorization code")
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if record.ExpiresAt.Before(time.Now()) {
+		return TokenResponse{}, oauthError("invalid_grant", "Authorization code expired")
+	}
+	if record.ClientID != client.ClientID {
+		return TokenResponse{}, oauthError("invalid_grant", "Authorization code was issued to another client")
+	}
+	if record.RedirectURI != redirectURI {
+		return TokenResponse{}, oauthError("invalid_grant", "redirect_uri doesn't match the authorization request")
+	}
+	if !VerifyCodeChallenge(codeVerifier, record.CodeChallenge) {
+		return TokenResponse{}, oauthError("invalid_grant", "code_verifier doesn't match the code_challenge")
+	}
+
+	var user models.User
+	if result := initializers.DB.Take(&user, "username = ?", record.UserID); result.Error != nil || !user.IsActive {
+		return TokenResponse{}, oauthError("invalid_grant", "User is no longer active")
+	}
+
+	// Each grant gets a session of its own, so the user sees and can end it like any other login.
+	now := time.Now()
+	expiresAt := now.Add(tokens.AccessTokenTTL())
+	session, err := tokens.CreateSession(user, ip, fmt.Sprintf("%s (OAuth client %s)", userAgent, client.Name), expiresAt)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	accessToken, err := tokens.Sign(jwt.MapClaims{
+		"iss":       issuer,
+		"sub":       user.Username,
+		"aud":       client.ClientID,
+		"scope":     record.Scope,
+		"sid":       session.ID,
+		"jti":       uuid.New().String(),
+		"ver":       user.TokenVersion,
+		"token_use": "access",
+		"iat":       now.Unix(),
+		"exp":       expiresAt.Unix(),
+	})
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	response := TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(tokens.AccessTokenTTL().Seconds()),
+		Scope:       record.Scope,
+	}
+	if hasScope(record.Scope, ScopeOpenID) {
+		claims, err := UserClaims(user, record.Scope)
+		if err != nil {
+			return TokenResponse{}, err
+		}
+		claims["iss"] = issuer
+		claims["aud"] = client.ClientID
+		claims["iat"] = now.Unix()
+		claims["exp"] = expiresAt.Unix()
+		claims["auth_time"] = record.AuthTime.Unix()
+		claims["sid"] = session.ID
+		if len(record.Nonce) > 0 {
+			claims["nonce"] = record.Nonce
+		}
+		if response.IDToken, err = tokens.Sign(claims); err != nil {
+			return TokenResponse{}, err
+		}
+	}
+	return response, nil
+}
+
+// VerifyCodeChallenge checks a PKCE code_verifier against an S256 code_challenge.
+func VerifyCodeChallenge(verifier string, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// UserClaims returns the claims about user released for scope, as used by id_tokens and the userinfo endpoint.
+func UserClaims(user models.User, scope string) (jwt.MapClaims, error) {
+
+	claims := jwt.MapClaims{"sub": user.Username}
+	if hasScope(scope, ScopeProfile) {
+		claims["preferred_username"] = user.Username
+		claims["name"] = user.Username
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if hasScope(scope, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.IsActive
+	}
+	if hasScope(scope, ScopeRoles) || hasScope(scope, ScopeGroups) {
+		resolution, err := authz.Resolve(user.Username)
+		if err != nil {
+			return nil, err
+		}
+		if hasScope(scope, ScopeRoles) {
+			roles := []string{}
+			for _, role := range resolution.Roles {
+				roles = append(roles, role.Name)
+			}
+			claims["roles"] = roles
+			claims["is_admin"] = user.IsAdmin
+		}
+		if hasScope(scope, ScopeGroups) {
+			groups := []string{}
+			for _, group := range resolution.Groups {
+				groups = append(groups, group.Name)
+			}
+			claims["groups"] = groups
+		}
+	}
+	return claims, nil
+}
+
+// VerifyAccessToken checks an access token issued to a client and returns its user and scope.
+func VerifyAccessToken(tokenString string) (models.User, string, error) {
+
+	var user models.User
+	claims, err := tokens.Verify(tokenString)
+	if err != nil {
+		return user, "", err
+	}
+	if claims["token_use"] != "access" || claims["iss"] != issuer {
+		return user, "", tokens.ErrInvalidToken
+	}
+	if _, ok := claims["aud"].(string); !ok {
+		return user, "", tokens.ErrInvalidToken
+	}
+	username, _ := claims["sub"].(string)
+	sessionID, _ := claims["sid"].(string)
+	scope, _ := claims["scope"].(string)
+	if result := initializers.DB.Take(&user, "username = ?", username); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return user, "", tokens.ErrInvalidToken
+		}
+		return user, "", result.Error
+	}
+	if !user.IsActive {
+		return user, "", tokens.ErrInactiveUser
+	}
+	if version, _ := claims["ver"].(float64); uint(version) != user.TokenVersion {
+		return user, "", tokens.ErrRevokedToken
+	}
+	if err := tokens.CheckSession(sessionID, user.Username); err != nil {
+		return user, "", err
+	}
+	return user, scope, nil
+}
+
+// Discovery returns the OpenID Connect discovery document.
+func Discovery() map[string]interface{} {
+	return map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{tokens.SigningAlgorithm()},
+		"scopes_supported":                      SupportedScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "sid",
+			"preferred_username", "name", "updated_at", "email", "email_verified", "roles", "is_admin", "groups",
+		},
+	}
+}
+
+// PurgeExpiredCodes deletes authorization codes that expired before now.
+func PurgeExpiredCodes(now time.Time) (int64, error) {
+	result := initializers.DB.Delete(&models.OAuthAuthorizationCode{}, "expires_at < ?", now)
+	return result.RowsAffected, result.Error
+}
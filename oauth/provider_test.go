@@ -0,0 +1,346 @@
+package oauth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/oauth"
+	"github.com/guptaharsh13/balkanid-task/routes"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"github.com/guptaharsh13/balkanid-task/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// relyingParty is a client application served by httptest. Its callback records what the provider
+// redirected the browser back with.
+type relyingParty struct {
+	t        *testing.T
+	server   *httptest.Server
+	provider string
+	client   oauth.Client
+	callback chan url.Values
+}
+
+func newRelyingParty(t *testing.T, provider string) *relyingParty {
+
+	rp := &relyingParty{t: t, provider: provider, callback: make(chan url.Values, 1)}
+	rp.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		rp.callback <- r.URL.Query()
+		fmt.Fprint(w, "signed in")
+	}))
+	t.Cleanup(rp.server.Close)
+
+	client, _, err := oauth.RegisterClient("Relying Party", []string{rp.redirectURI()}, false, "admin")
+	if err != nil {
+		t.Fatalf("Couldn't register client: %s", err)
+	}
+	rp.client = client
+	return rp
+}
+
+func (rp *relyingParty) redirectURI() string {
+	return rp.server.URL + "/callback"
+}
+
+// authorizeURL builds the authorization request a relying party sends the browser to.
+func (rp *relyingParty) authorizeURL(state string, nonce string, verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return rp.provider + "/oauth/authorize?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {rp.client.ClientID},
+		"redirect_uri":          {rp.redirectURI()},
+		"scope":                 {"openid profile email"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+}
+
+// exchange redeems code at the token endpoint and returns the status and decoded body.
+func (rp *relyingParty) exchange(code string, verifier string) (int, map[string]interface{}) {
+
+	response, err := http.PostForm(rp.provider+"/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {rp.client.ClientID},
+		"code":          {code},
+		"redirect_uri":  {rp.redirectURI()},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		rp.t.Fatalf("Couldn't reach token endpoint: %s", err)
+	}
+	defer response.Body.Close()
+	body := map[string]interface{}{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		rp.t.Fatalf("Couldn't decode token response: %s", err)
+	}
+	return response.StatusCode, body
+}
+
+// verifyIDToken checks an id_token the way a relying party does: signature against the published JWKS,
+// issuer, audience and nonce.
+func (rp *relyingParty) verifyIDToken(idToken string, nonce string) jwt.MapClaims {
+
+	response, err := http.Get(rp.provider + "/.well-known/jwks.json")
+	if err != nil {
+		rp.t.Fatalf("Couldn't fetch jwks: %s", err)
+	}
+	defer response.Body.Close()
+	var jwks struct {
+		Keys []tokens.JWK `json:"keys"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&jwks); err != nil {
+		rp.t.Fatalf("Couldn't decode jwks: %s", err)
+	}
+
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		for _, key := range jwks.Keys {
+			if key.KeyID != token.Header["kid"] {
+				continue
+			}
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil {
+				return nil, err
+			}
+			return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+		}
+		return nil, errors.New("unknown kid")
+	})
+	if err != nil {
+		rp.t.Fatalf("id_token doesn't verify against the jwks: %s", err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["iss"] != rp.provider {
+		rp.t.Errorf("id_token issuer is %v, want %s", claims["iss"], rp.provider)
+	}
+	if claims["aud"] != rp.client.ClientID {
+		rp.t.Errorf("id_token audience is %v, want %s", claims["aud"], rp.client.ClientID)
+	}
+	if claims["nonce"] != nonce {
+		rp.t.Errorf("id_token nonce is %v, want %s", claims["nonce"], nonce)
+	}
+	return claims
+}
+
+func setupProvider(t *testing.T) (string, *http.Client) {
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Couldn't open database: %s", err)
+	}
+	initializers.DB = db
+	initializers.SyncDatabase()
+	if err := utils.SetupValidator(); err != nil {
+		t.Fatalf("Couldn't setup validator: %s", err)
+	}
+	if err := tokens.ConfigureKeys(tokens.AlgorithmRS256, time.Hour); err != nil {
+		t.Fatalf("Couldn't setup signing keys: %s", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	routes.OAuthRouter(r)
+	routes.KeyRouter(r)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	oauth.Configure(server.URL, time.Minute)
+
+	for _, user := range []models.User{
+		{Username: "admin", Email: "admin@example.com", IsActive: true, IsAdmin: true},
+		{Username: "alice", Email: "alice@example.com", IsActive: true},
+	} {
+		if result := db.Create(&user); result.Error != nil {
+			t.Fatalf("Couldn't create user: %s", result.Error)
+		}
+	}
+
+	// The browser keeps cookies but stops at redirects, so each hop can be looked at.
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	return server.URL, browser
+}
+
+// signIn gives the browser the session cookie the login page sets for alice.
+func signIn(t *testing.T, provider string, browser *http.Client) {
+
+	var alice models.User
+	initializers.DB.Take(&alice, "username = ?", "alice")
+	session, expiresAt, err := oauth.StartBrowserSession(alice, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Couldn't start browser session: %s", err)
+	}
+	target, _ := url.Parse(provider + "/oauth")
+	browser.Jar.SetCookies(target, []*http.Cookie{{Name: oauth.SessionCookie, Value: session, Path: "/oauth", Expires: expiresAt}})
+}
+
+// authorize sends the browser to the authorization endpoint and follows it back to the relying party.
+func authorize(t *testing.T, rp *relyingParty, browser *http.Client, state string, nonce string, verifier string) url.Values {
+
+	response, err := browser.Get(rp.authorizeURL(state, nonce, verifier))
+	if err != nil {
+		t.Fatalf("Couldn't reach authorization endpoint: %s", err)
+	}
+	response.Body.Close()
+	location := response.Header.Get("Location")
+	if response.StatusCode != http.StatusFound || !strings.HasPrefix(location, rp.redirectURI()) {
+		t.Fatalf("Authorization endpoint answered %d to %q, want a redirect to the client", response.StatusCode, location)
+	}
+	response, err = browser.Get(location)
+	if err != nil {
+		t.Fatalf("Couldn't reach relying party: %s", err)
+	}
+	response.Body.Close()
+	return <-rp.callback
+}
+
+func newVerifier(t *testing.T) string {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+
+	provider, browser := setupProvider(t)
+	rp := newRelyingParty(t, provider)
+	verifier := newVerifier(t)
+
+	// Without a session the browser is sent to the login page, which returns to the same request.
+	response, err := browser.Get(rp.authorizeURL("state-1", "nonce-1", verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	location, _ := url.Parse(response.Header.Get("Location"))
+	if response.StatusCode != http.StatusFound || location.Path != "/oauth/login" {
+		t.Fatalf("Authorization endpoint answered %d to %q, want a redirect to the login page", response.StatusCode, location)
+	}
+	if returnTo := location.Query().Get("return_to"); !oauth.ValidReturnTo(returnTo) || !strings.Contains(returnTo, "nonce-1") {
+		t.Fatalf("Login page would return to %q", returnTo)
+	}
+
+	signIn(t, provider, browser)
+	callback := authorize(t, rp, browser, "state-1", "nonce-1", verifier)
+	if callback.Get("state") != "state-1" {
+		t.Fatalf("Callback state is %q", callback.Get("state"))
+	}
+	code := callback.Get("code")
+	if len(code) == 0 {
+		t.Fatalf("Callback has no code: %v", callback)
+	}
+
+	status, body := rp.exchange(code, verifier)
+	if status != http.StatusOK {
+		t.Fatalf("Token endpoint answered %d: %v", status, body)
+	}
+	claims := rp.verifyIDToken(body["id_token"].(string), "nonce-1")
+	if claims["sub"] != "alice" || claims["email"] != "alice@example.com" {
+		t.Errorf("id_token claims are %v", claims)
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, provider+"/oauth/userinfo", nil)
+	request.Header.Set("Authorization", "Bearer "+body["access_token"].(string))
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var userinfo map[string]interface{}
+	if err := json.NewDecoder(response.Body).Decode(&userinfo); err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || userinfo["sub"] != "alice" || userinfo["preferred_username"] != "alice" {
+		t.Errorf("Userinfo answered %d: %v", response.StatusCode, userinfo)
+	}
+
+	// A code is good for one exchange only.
+	if status, body := rp.exchange(code, verifier); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("Reused code got %d: %v", status, body)
+	}
+}
+
+func TestWrongCodeVerifier(t *testing.T) {
+
+	provider, browser := setupProvider(t)
+	rp := newRelyingParty(t, provider)
+	signIn(t, provider, browser)
+	verifier := newVerifier(t)
+	code := authorize(t, rp, browser, "state-2", "nonce-2", verifier).Get("code")
+
+	if status, body := rp.exchange(code, newVerifier(t)); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Fatalf("Wrong code_verifier got %d: %v", status, body)
+	}
+	// The failed attempt used the code up.
+	if status, body := rp.exchange(code, verifier); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("Code after a wrong code_verifier got %d: %v", status, body)
+	}
+}
+
+func TestRevokedBrowserSession(t *testing.T) {
+
+	provider, browser := setupProvider(t)
+	rp := newRelyingParty(t, provider)
+	signIn(t, provider, browser)
+	if _, err := tokens.RevokeSessions("alice", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := browser.Get(rp.authorizeURL("state-3", "nonce-3", newVerifier(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	location, _ := url.Parse(response.Header.Get("Location"))
+	if response.StatusCode != http.StatusFound || location.Path != "/oauth/login" {
+		t.Fatalf("Revoked session got %d to %q, want a redirect to the login page", response.StatusCode, location)
+	}
+}
+
+func TestValidReturnTo(t *testing.T) {
+	for returnTo, valid := range map[string]bool{
+		"/oauth/authorize?client_id=x":         true,
+		"https://evil.example/oauth/authorize": false,
+		"//evil.example/oauth/authorize":       false,
+		"/users/me":                            false,
+	} {
+		if oauth.ValidReturnTo(returnTo) != valid {
+			t.Errorf("ValidReturnTo(%q) = %v, want %v", returnTo, !valid, valid)
+		}
+	}
+}
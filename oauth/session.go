@@ -0,0 +1,103 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/tokens"
+	"gorm.io/gorm"
+)
+
+// SessionCookie carries the browser session the authorization endpoint signs users in with. Relying parties
+// send the browser there with a plain redirect, which never carries an Authorization header.
+const SessionCookie = "oauth_session"
+
+// browserSessionTTL is how long a sign-in at the login page lasts before the user has to sign in again.
+const browserSessionTTL = 12 * time.Hour
+
+// StartBrowserSession records a sign-in of user at the login page and returns the value of its cookie.
+// The session is listed and revoked like any other login.
+func StartBrowserSession(user models.User, ip string, userAgent string) (string, time.Time, error) {
+
+	now := time.Now()
+	expiresAt := now.Add(browserSessionTTL)
+	session, err := tokens.CreateSession(user, ip, fmt.Sprintf("%s (OAuth sign-in)", userAgent), expiresAt)
+	if err != nil {
+		return "", expiresAt, err
+	}
+	// The audience keeps the cookie from being accepted as an access token by the API.
+	value, err := tokens.Sign(jwt.MapClaims{
+		"iss":       issuer,
+		"aud":       issuer,
+		"sub":       user.Username,
+		"sid":       session.ID,
+		"ver":       user.TokenVersion,
+		"token_use": "browser",
+		"iat":       now.Unix(),
+		"exp":       expiresAt.Unix(),
+	})
+	return value, expiresAt, err
+}
+
+// BrowserSession checks the value of a session cookie and returns its user and when they signed in.
+func BrowserSession(value string) (models.User, time.Time, error) {
+
+	var user models.User
+	claims, err := tokens.Verify(value)
+	if err != nil {
+		return user, time.Time{}, err
+	}
+	if claims["token_use"] != "browser" || claims["iss"] != issuer || claims["aud"] != issuer {
+		return user, time.Time{}, tokens.ErrInvalidToken
+	}
+	username, _ := claims["sub"].(string)
+	sessionID, _ := claims["sid"].(string)
+	if result := initializers.DB.Take(&user, "username = ?", username); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return user, time.Time{}, tokens.ErrInvalidToken
+		}
+		return user, time.Time{}, result.Error
+	}
+	if !user.IsActive {
+		return user, time.Time{}, tokens.ErrInactiveUser
+	}
+	if version, _ := claims["ver"].(float64); uint(version) != user.TokenVersion {
+		return user, time.Time{}, tokens.ErrRevokedToken
+	}
+	if err := tokens.CheckSession(sessionID, user.Username); err != nil {
+		return user, time.Time{}, err
+	}
+	var session models.Session
+	if result := initializers.DB.Take(&session, "id = ?", sessionID); result.Error != nil {
+		return user, time.Time{}, result.Error
+	}
+	return user, session.CreatedAt, nil
+}
+
+// LoginURL is where the authorization endpoint sends browsers without a session, to come back to the
+// authorization request at returnTo once signed in.
+func LoginURL(returnTo string) string {
+	return "/oauth/login?" + url.Values{"return_to": {returnTo}}.Encode()
+}
+
+// ValidReturnTo reports whether the login page may send the browser to returnTo, which only ever is
+// the authorization endpoint of this provider.
+func ValidReturnTo(returnTo string) bool {
+	target, err := url.Parse(returnTo)
+	if err != nil || len(target.Scheme) > 0 || len(target.Host) > 0 || strings.HasPrefix(returnTo, "//") {
+		return false
+	}
+	return target.Path == "/oauth/authorize"
+}
+
+// SecureCookies reports whether cookies should only be sent over https, which is the case unless the
+// issuer itself is served over plain http.
+func SecureCookies() bool {
+	return strings.HasPrefix(issuer, "https://")
+}
@@ -0,0 +1,82 @@
+package reminders
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/mailer"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"github.com/guptaharsh13/balkanid-task/notify"
+	"gorm.io/gorm/clause"
+)
+
+var leadTime = 24 * time.Hour
+
+// Configure sets how long before the due date of a task its asignees are reminded.
+func Configure(lead time.Duration) {
+	leadTime = lead
+}
+
+// Data is what the task_reminder template is rendered with.
+type Data struct {
+	Username string
+	TaskName string
+	DueDate  string
+	Overdue  bool
+	Link     string
+}
+
+// Run reminds the asignees of unfinished tasks that are due within the lead time or overdue. Each reminder
+// is claimed in the database before it's sent, so replicas running at the same time don't send it twice.
+// It returns how many reminders were sent.
+func Run(now time.Time) (int, error) {
+
+	var tasks []models.Task
+	result := initializers.DB.Preload("Asignees").
+		Where("due_date IS NOT NULL AND due_date <= ?", now.Add(leadTime)).
+		Where("status NOT IN (?)", initializers.DB.Model(&models.TaskState{}).Select("name").Where("is_final = ?", true)).
+		Find(&tasks)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	sent := 0
+	for _, task := range tasks {
+		kind := models.ReminderDueSoon
+		if task.DueDate.Before(now) {
+			kind = models.ReminderOverdue
+		}
+		for _, asignee := range task.Asignees {
+			reminder := models.TaskReminder{TaskID: task.ID, Username: asignee.Username, Kind: kind, DueDate: *task.DueDate, SentAt: now}
+			claim := initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&reminder)
+			if claim.Error != nil {
+				return sent, claim.Error
+			}
+			if claim.RowsAffected == 0 {
+				continue
+			}
+			err := notify.Send(notify.Notification{
+				User:     asignee,
+				Template: mailer.TemplateTaskReminder,
+				Data: Data{
+					Username: asignee.Username,
+					TaskName: task.Name,
+					DueDate:  task.DueDate.UTC().Format("Mon, 02 Jan 2006 15:04 MST"),
+					Overdue:  kind == models.ReminderOverdue,
+					Link:     fmt.Sprintf("%s/tasks/%d", mailer.AppURL(), task.ID),
+				},
+			})
+			if err != nil {
+				// Releasing the claim lets the next run try again.
+				fmt.Printf("Couldn't remind %s of task %d: %s\n", asignee.Username, task.ID, err.Error())
+				if result := initializers.DB.Delete(&reminder); result.Error != nil {
+					return sent, result.Error
+				}
+				continue
+			}
+			sent++
+		}
+	}
+	return sent, nil
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/controllers"
+	"github.com/guptaharsh13/balkanid-task/middleware"
+)
+
+func AuthzRouter(r *gin.Engine) {
+	authorization := r.Group("/authz")
+	authorization.Use(middleware.RequireAuth)
+	{
+		authorization.POST("/check", controllers.CheckAuthorization)
+	}
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/controllers"
+	"github.com/guptaharsh13/balkanid-task/middleware"
+)
+
+func FederationRouter(r *gin.Engine) {
+	mappings := r.Group("/federation/mappings")
+	mappings.Use(middleware.IsAdmin)
+	{
+		mappings.POST("/", controllers.CreateGroupMapping)
+		mappings.GET("/", controllers.GetGroupMappings)
+		mappings.DELETE("/:id", controllers.DeleteGroupMapping)
+	}
+}
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/guptaharsh13/balkanid-task/controllers"
 	"github.com/guptaharsh13/balkanid-task/middleware"
@@ -8,16 +10,17 @@ import (
 
 func GroupRouter(r *gin.Engine) {
 	groups := r.Group("/groups")
-	groups.Use(middleware.IsAdmin)
+	groups.Use(middleware.RequireAuth)
 	{
-		groups.POST("/", controllers.CreateGroup)
-		groups.GET("/", controllers.GetGroups)
-		groups.GET("/:name", controllers.GetGroupByName)
-		groups.PUT("/:name", controllers.UpdateGroupPut)
-		groups.PATCH("/:name", controllers.UpdateGroupPatch)
-		groups.DELETE("/:name", controllers.DeleteGroup)
-		groups.POST("/:name/permissions", controllers.AddPermissionsToGroup)
-		groups.POST("/:name/users", controllers.AddUsersToGroup)
-		groups.GET("/:name/users", controllers.GetUsersByGroup)
+		guard(groups, http.MethodPost, "/", "groups", "CREATE", controllers.CreateGroup)
+		guard(groups, http.MethodGet, "/", "groups", "READ", controllers.GetGroups)
+		guard(groups, http.MethodGet, "/:name", "groups", "READ", controllers.GetGroupByName)
+		guard(groups, http.MethodPut, "/:name", "groups", "UPDATE", controllers.UpdateGroupPut)
+		guard(groups, http.MethodPatch, "/:name", "groups", "UPDATE", controllers.UpdateGroupPatch)
+		guard(groups, http.MethodDelete, "/:name", "groups", "DELETE", controllers.DeleteGroup)
+		guard(groups, http.MethodPost, "/:name/permissions", "groups", "UPDATE", controllers.AddPermissionsToGroup)
+		guard(groups, http.MethodPost, "/:name/users", "groups", "UPDATE", controllers.AddUsersToGroup)
+		guard(groups, http.MethodGet, "/:name/users", "groups", "READ", controllers.GetUsersByGroup)
+		guard(groups, http.MethodPost, "/:name/simulate", "groups", "UPDATE", controllers.SimulateGroupChange)
 	}
 }
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
+	"github.com/guptaharsh13/balkanid-task/middleware"
+)
+
+// guard registers a route behind middleware.RequirePermission and records it for the authorization simulator.
+// The group must already require authentication.
+func guard(group *gin.RouterGroup, method string, path string, table string, operation string, handlers ...gin.HandlerFunc) {
+	authz.RegisterRoute(authz.RouteRule{Method: method, Path: joinPaths(group.BasePath(), path), Table: table, Operation: operation})
+	group.Handle(method, path, append([]gin.HandlerFunc{middleware.RequirePermission(table, operation)}, handlers...)...)
+}
+
+// guardResource is guard for routes acting on the single object named by param, see middleware.AuthorizeResource.
+func guardResource(group *gin.RouterGroup, method string, path string, table string, operation string, param string, handlers ...gin.HandlerFunc) {
+	authz.RegisterRoute(authz.RouteRule{Method: method, Path: joinPaths(group.BasePath(), path), Table: table, Operation: operation, Scoped: true})
+	group.Handle(method, path, append([]gin.HandlerFunc{middleware.AuthorizeResource(table, operation, param)}, handlers...)...)
+}
+
+// guardRelated registers a route that authorizes in its handler, letting users related to the object through
+// relations act on it without a grant. Only the token scope is checked up front.
+func guardRelated(group *gin.RouterGroup, method string, path string, table string, operation string, relations []string, handlers ...gin.HandlerFunc) {
+	authz.RegisterRoute(authz.RouteRule{Method: method, Path: joinPaths(group.BasePath(), path), Table: table, Operation: operation,
+		Scoped: strings.Contains(path, ":"), Relations: relations})
+	group.Handle(method, path, append([]gin.HandlerFunc{middleware.RequireScope(table, operation)}, handlers...)...)
+}
+
+func joinPaths(base string, path string) string {
+	return strings.TrimSuffix(base, "/") + path
+}
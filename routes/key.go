@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/controllers"
+	"github.com/guptaharsh13/balkanid-task/middleware"
+)
+
+func KeyRouter(r *gin.Engine) {
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
+	keys := r.Group("/keys")
+	keys.Use(middleware.IsAdmin)
+	{
+		keys.POST("/rotate", controllers.RotateSigningKeys)
+	}
+}
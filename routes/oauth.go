@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/controllers"
+	"github.com/guptaharsh13/balkanid-task/middleware"
+)
+
+func OAuthRouter(r *gin.Engine) {
+	r.GET("/.well-known/openid-configuration", controllers.OpenIDConfiguration)
+	oauth := r.Group("/oauth")
+	{
+		oauth.GET("/authorize", controllers.Authorize)
+		oauth.POST("/authorize", controllers.Authorize)
+		oauth.GET("/login", controllers.OAuthLoginPage)
+		oauth.POST("/login", controllers.OAuthLogin)
+		oauth.POST("/token", controllers.Token)
+		oauth.GET("/userinfo", controllers.UserInfo)
+		oauth.POST("/userinfo", controllers.UserInfo)
+	}
+	clients := oauth.Group("/clients")
+	clients.Use(middleware.IsAdmin)
+	{
+		clients.POST("/", controllers.CreateOAuthClient)
+		clients.GET("/", controllers.GetOAuthClients)
+		clients.DELETE("/:client_id", controllers.DeleteOAuthClient)
+	}
+}
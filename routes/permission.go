@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/controllers"
+	"github.com/guptaharsh13/balkanid-task/middleware"
+)
+
+func PermissionRouter(r *gin.Engine) {
+	permissions := r.Group("/permissions")
+	permissions.Use(middleware.RequireAuth)
+	{
+		guard(permissions, http.MethodPost, "/", "permissions", "CREATE", controllers.CreatePermission)
+		guard(permissions, http.MethodGet, "/", "permissions", "READ", controllers.GetPermissions)
+		guard(permissions, http.MethodGet, "/:name", "permissions", "READ", controllers.GetPermissionByName)
+		guard(permissions, http.MethodPut, "/:name", "permissions", "UPDATE", controllers.UpdatePermissionPut)
+		guard(permissions, http.MethodPatch, "/:name", "permissions", "UPDATE", controllers.UpdatePermissionPatch)
+		guard(permissions, http.MethodDelete, "/:name", "permissions", "DELETE", controllers.DeletePermission)
+	}
+}
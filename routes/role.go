@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/guptaharsh13/balkanid-task/controllers"
 	"github.com/guptaharsh13/balkanid-task/middleware"
@@ -8,16 +10,18 @@ import (
 
 func RoleRouter(r *gin.Engine) {
 	roles := r.Group("/roles")
-	roles.Use(middleware.IsAdmin)
+	roles.Use(middleware.RequireAuth)
 	{
-		roles.POST("/", controllers.CreateRole)
-		roles.GET("/", controllers.GetRoles)
-		roles.GET("/:name", controllers.GetRoleByName)
-		roles.PUT("/:name", controllers.UpdateRolePut)
-		roles.PATCH("/:name", controllers.UpdateRolePatch)
-		roles.DELETE("/:name", controllers.DeleteRole)
-		roles.POST("/:name/permissions", controllers.AddPermissionsToRole)
-		roles.POST("/:name/users", controllers.AssignRoleToUser)
-		roles.GET("/:name/users", controllers.GetUsersByRole)
+		guard(roles, http.MethodPost, "/", "roles", "CREATE", controllers.CreateRole)
+		guard(roles, http.MethodGet, "/", "roles", "READ", controllers.GetRoles)
+		guard(roles, http.MethodGet, "/:name", "roles", "READ", controllers.GetRoleByName)
+		guard(roles, http.MethodPut, "/:name", "roles", "UPDATE", controllers.UpdateRolePut)
+		guard(roles, http.MethodPatch, "/:name", "roles", "UPDATE", controllers.UpdateRolePatch)
+		guard(roles, http.MethodDelete, "/:name", "roles", "DELETE", controllers.DeleteRole)
+		guard(roles, http.MethodPost, "/:name/permissions", "roles", "UPDATE", controllers.AddPermissionsToRole)
+		guard(roles, http.MethodPost, "/:name/users", "roles", "UPDATE", controllers.AssignRoleToUser)
+		guard(roles, http.MethodDelete, "/:name/users/:username", "roles", "UPDATE", controllers.RemoveRoleFromUser)
+		guard(roles, http.MethodGet, "/:name/users", "roles", "READ", controllers.GetUsersByRole)
+		guard(roles, http.MethodPost, "/:name/simulate", "roles", "UPDATE", controllers.SimulateRoleChange)
 	}
 }
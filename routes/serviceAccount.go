@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/controllers"
+	"github.com/guptaharsh13/balkanid-task/middleware"
+)
+
+func ServiceAccountRouter(r *gin.Engine) {
+	serviceAccounts := r.Group("/service-accounts")
+	serviceAccounts.Use(middleware.RequireSession)
+	{
+		guard(serviceAccounts, http.MethodPost, "/", "users", "CREATE", controllers.CreateServiceAccount)
+		guard(serviceAccounts, http.MethodGet, "/", "users", "READ", controllers.GetServiceAccounts)
+		guard(serviceAccounts, http.MethodGet, "/:username/tokens", "users", "READ", controllers.GetServiceAccountTokens)
+		guard(serviceAccounts, http.MethodPost, "/:username/tokens", "users", "UPDATE", controllers.CreateServiceAccountToken)
+		guard(serviceAccounts, http.MethodDelete, "/:username/tokens/:id", "users", "UPDATE", controllers.RevokeServiceAccountToken)
+	}
+}
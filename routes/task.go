@@ -1,19 +1,36 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/authz"
 	"github.com/guptaharsh13/balkanid-task/controllers"
 	"github.com/guptaharsh13/balkanid-task/middleware"
 )
 
 func TaskRouter(r *gin.Engine) {
+	creator := []string{authz.RelationCreator}
+	assigned := []string{authz.RelationCreator, authz.RelationAsignee}
+	visible := []string{authz.RelationVisible}
+
 	tasks := r.Group("/tasks")
+	tasks.Use(middleware.RequireAuth)
 	{
-		tasks.POST("/", middleware.RequireAuth, controllers.CreateTask)
-		tasks.GET("/", middleware.IsAdmin, controllers.GetTasks)
-		tasks.GET("/:id", middleware.IsAdmin, controllers.GetTaskByID)
-		tasks.DELETE("/:id", middleware.RequireAuth, controllers.DeleteTask)
-		tasks.POST("/upload", middleware.IsAdmin, controllers.BulkUploadTasks)
-		tasks.POST("/:id/asignees", middleware.RequireAuth, controllers.AssignTaskToUsers)
+		tasks.POST("/", middleware.RequireScope("tasks", "CREATE"), controllers.CreateTask)
+		guardRelated(tasks, http.MethodGet, "/", "tasks", "READ", visible, controllers.GetTasks)
+		guardRelated(tasks, http.MethodGet, "/:id", "tasks", "READ", visible, controllers.GetTaskByID)
+		guardRelated(tasks, http.MethodPut, "/:id", "tasks", "UPDATE", creator, controllers.UpdateTaskPut)
+		guardRelated(tasks, http.MethodPatch, "/:id", "tasks", "UPDATE", creator, controllers.UpdateTaskPatch)
+		guardRelated(tasks, http.MethodDelete, "/:id", "tasks", "DELETE", creator, controllers.DeleteTask)
+		guard(tasks, http.MethodPost, "/upload", "tasks", "CREATE", controllers.BulkUploadTasks)
+		guardRelated(tasks, http.MethodPost, "/:id/asignees", "tasks", "UPDATE", creator, controllers.AssignTaskToUsers)
+		guardRelated(tasks, http.MethodGet, "/:id/transitions", "tasks", "READ", visible, controllers.GetTaskTransitions)
+		guardRelated(tasks, http.MethodPost, "/:id/transitions", "tasks", "UPDATE", assigned, controllers.TransitionTask)
+		guardRelated(tasks, http.MethodGet, "/:id/comments", "tasks", "READ", visible, controllers.GetTaskComments)
+		tasks.POST("/:id/comments", middleware.RequireScope("tasks", "UPDATE"), controllers.CreateTaskComment)
+		tasks.PATCH("/:id/comments/:comment", middleware.RequireScope("tasks", "UPDATE"), controllers.UpdateTaskComment)
+		tasks.DELETE("/:id/comments/:comment", middleware.RequireScope("tasks", "UPDATE"), controllers.DeleteTaskComment)
+		guardRelated(tasks, http.MethodGet, "/:id/activity", "tasks", "READ", visible, controllers.GetTaskActivity)
 	}
 }
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/guptaharsh13/balkanid-task/controllers"
 	"github.com/guptaharsh13/balkanid-task/middleware"
@@ -11,13 +13,44 @@ func UserRouter(r *gin.Engine) {
 	{
 		users.POST("/signup", controllers.Signup)
 		users.POST("/login", controllers.Login)
+		users.POST("/login/2fa", controllers.LoginTwoFactor)
+		users.POST("/login/2fa/enroll", controllers.EnrollTwoFactorAtLogin)
+		users.GET("/login/oidc", controllers.FederatedLogin)
+		users.GET("/login/oidc/callback", controllers.FederatedLoginCallback)
 		users.POST("/verify/:username", controllers.VerifyEmail)
 		users.GET("/activate/:username/:code", controllers.ActivateUser)
-		users.POST("/deactivate/:username", middleware.IsAdmin, controllers.DeactivateUser)
+		users.POST("/refresh", controllers.RefreshToken)
+		users.POST("/password/forgot", controllers.ForgotPassword)
+		users.POST("/password/reset", controllers.ResetPassword)
+		users.POST("/logout", middleware.RequireSession, controllers.Logout)
 		users.GET("/me", middleware.RequireAuth, controllers.GetCurrentUser)
-		users.GET("/", middleware.IsAdmin, controllers.GetUsers)
-		users.GET("/:username", middleware.IsAdmin, controllers.GetUserByUsername)
-		users.DELETE("/:username", middleware.IsAdmin, controllers.DeleteUser)
-		users.POST("/upload", middleware.IsAdmin, controllers.BulkUploadUsers)
+		users.POST("/me/password", middleware.RequireSession, controllers.ChangePassword)
+		users.POST("/me/2fa/enroll", middleware.RequireSession, controllers.EnrollTwoFactor)
+		users.POST("/me/2fa/confirm", middleware.RequireSession, controllers.ConfirmTwoFactor)
+		users.POST("/me/2fa/recovery-codes", middleware.RequireSession, controllers.RegenerateRecoveryCodes)
+		users.DELETE("/me/2fa", middleware.RequireSession, controllers.DisableTwoFactor)
+		users.GET("/me/sessions", middleware.RequireSession, controllers.GetSessions)
+		users.DELETE("/me/sessions", middleware.RequireSession, controllers.RevokeOtherSessions)
+		users.DELETE("/me/sessions/:id", middleware.RequireSession, controllers.RevokeSession)
+		users.GET("/me/tokens", middleware.RequireSession, controllers.GetAPITokens)
+		users.POST("/me/tokens", middleware.RequireSession, controllers.CreateAPIToken)
+		users.DELETE("/me/tokens/:id", middleware.RequireSession, controllers.RevokeAPIToken)
+		users.GET("/me/identities", middleware.RequireSession, controllers.GetFederatedIdentities)
+	}
+	protected := users.Group("")
+	protected.Use(middleware.RequireAuth)
+	{
+		guardResource(protected, http.MethodPost, "/deactivate/:username", "users", "UPDATE", "username", controllers.DeactivateUser)
+		guard(protected, http.MethodGet, "/", "users", "READ", controllers.GetUsers)
+		guard(protected, http.MethodGet, "/lockouts", "users", "READ", controllers.GetLockouts)
+		guardResource(protected, http.MethodGet, "/:username", "users", "READ", "username", controllers.GetUserByUsername)
+		guard(protected, http.MethodGet, "/:username/permissions", "users", "READ", controllers.GetUserPermissions)
+		guardResource(protected, http.MethodDelete, "/:username", "users", "DELETE", "username", controllers.DeleteUser)
+		guard(protected, http.MethodGet, "/:username/sessions", "users", "READ", controllers.GetUserSessions)
+		guard(protected, http.MethodDelete, "/:username/sessions", "users", "UPDATE", controllers.RevokeUserSessions)
+		guard(protected, http.MethodDelete, "/:username/sessions/:id", "users", "UPDATE", controllers.RevokeUserSession)
+		guard(protected, http.MethodDelete, "/:username/lockout", "users", "UPDATE", controllers.UnlockUser)
+		guardResource(protected, http.MethodDelete, "/:username/2fa", "users", "UPDATE", "username", controllers.ResetTwoFactor)
+		guard(protected, http.MethodPost, "/upload", "users", "CREATE", controllers.BulkUploadUsers)
 	}
 }
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/guptaharsh13/balkanid-task/controllers"
+	"github.com/guptaharsh13/balkanid-task/middleware"
+)
+
+func WorkflowRouter(r *gin.Engine) {
+	r.GET("/workflow", middleware.RequireAuth, controllers.GetWorkflow)
+	workflow := r.Group("/workflow")
+	workflow.Use(middleware.IsAdmin)
+	{
+		workflow.POST("/states", controllers.CreateTaskState)
+		workflow.PATCH("/states/:name", controllers.UpdateTaskState)
+		workflow.DELETE("/states/:name", controllers.DeleteTaskState)
+		workflow.POST("/transitions", controllers.CreateTaskTransition)
+		workflow.DELETE("/transitions/:id", controllers.DeleteTaskTransition)
+	}
+}
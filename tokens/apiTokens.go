@@ -0,0 +1,100 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+)
+
+// APITokenPrefix tells API tokens apart from JWTs and makes leaked tokens easy to scan for.
+const APITokenPrefix = "bkt_"
+
+// lastUsedResolution limits how often using a token writes its last-used time.
+const lastUsedResolution = time.Minute
+
+var ErrExpiredAPIToken = errors.New("api token expired")
+
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// IssueAPIToken creates an API token of owner limited to permissions. The plain token is only returned here.
+func IssueAPIToken(owner models.User, name string, permissions []models.Permission, expiresAt *time.Time) (string, models.APIToken, error) {
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", models.APIToken{}, err
+	}
+	token := APITokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	record := models.APIToken{
+		Name:        name,
+		UserID:      owner.Username,
+		TokenHash:   Hash(token),
+		Prefix:      token[:len(APITokenPrefix)+6],
+		Permissions: permissions,
+		ExpiresAt:   expiresAt,
+	}
+	if result := initializers.DB.Create(&record); result.Error != nil {
+		return "", record, result.Error
+	}
+	return token, record, nil
+}
+
+// AuthenticateAPIToken returns the API token and its owner, and records the use from ip.
+func AuthenticateAPIToken(token string, ip string) (models.APIToken, models.User, error) {
+
+	var record models.APIToken
+	var user models.User
+	if result := initializers.DB.Preload("Permissions").Take(&record, "token_hash = ?", Hash(token)); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return record, user, ErrInvalidToken
+		}
+		return record, user, result.Error
+	}
+	now := time.Now()
+	if record.RevokedAt != nil {
+		return record, user, ErrRevokedToken
+	}
+	if record.ExpiresAt != nil && record.ExpiresAt.Before(now) {
+		return record, user, ErrExpiredAPIToken
+	}
+	if result := initializers.DB.Take(&user, "username = ?", record.UserID); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return record, user, ErrInvalidToken
+		}
+		return record, user, result.Error
+	}
+	if !user.IsActive {
+		return record, user, ErrInactiveUser
+	}
+
+	if record.LastUsedAt == nil || record.LastUsedAt.Add(lastUsedResolution).Before(now) || record.LastUsedIP != ip {
+		result := initializers.DB.Model(&models.APIToken{}).Where("id = ?", record.ID).
+			Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip})
+		if result.Error != nil {
+			return record, user, result.Error
+		}
+		record.LastUsedAt = &now
+		record.LastUsedIP = ip
+	}
+	return record, user, nil
+}
+
+func APITokens(username string) ([]models.APIToken, error) {
+	var records []models.APIToken
+	result := initializers.DB.Preload("Permissions").Order("created_at DESC").Find(&records, "user_id = ?", username)
+	return records, result.Error
+}
+
+// RevokeAPIToken revokes the API token id of username. It returns false when there is no such token.
+func RevokeAPIToken(username string, id string) (bool, error) {
+	result := initializers.DB.Model(&models.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, username).Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,352 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// keyRefreshInterval bounds how long a replica keeps signing with a key after another replica rotated it.
+const keyRefreshInterval = time.Minute
+
+// unknownKeyReloadInterval bounds how often tokens with an unknown kid make the keys be read again, so forged
+// tokens can't turn every request into a query.
+const unknownKeyReloadInterval = 5 * time.Second
+
+var ErrExpiredToken = errors.New("token expired")
+
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	createdAt time.Time
+	retiredAt *time.Time
+}
+
+type keySet struct {
+	mu       sync.RWMutex
+	keys     map[string]*signingKey
+	active   *signingKey
+	loadedAt time.Time
+	// missedAt is when an unknown kid last made the keys be read again.
+	missedAt time.Time
+}
+
+var (
+	keyAlgorithm = AlgorithmEdDSA
+	keyOverlap   = 24 * time.Hour
+	keys         = &keySet{}
+)
+
+// ConfigureKeys loads the signing keys and rotates to a new key when there is none for algorithm.
+// overlap is how long a retired key still verifies and should be longer than the access token TTL.
+func ConfigureKeys(algorithm string, overlap time.Duration) error {
+
+	if algorithm != AlgorithmRS256 && algorithm != AlgorithmEdDSA {
+		return fmt.Errorf("unsupported signing algorithm %s", algorithm)
+	}
+	keyAlgorithm = algorithm
+	keyOverlap = overlap
+
+	if err := keys.load(); err != nil {
+		return err
+	}
+	keys.mu.RLock()
+	active := keys.active
+	keys.mu.RUnlock()
+	if active == nil || active.method.Alg() != algorithm {
+		if _, err := RotateKeys(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func SigningAlgorithm() string {
+	return keyAlgorithm
+}
+
+// RotateKeys generates a new signing key and retires the current ones.
+func RotateKeys() (models.SigningKey, error) {
+
+	record, err := generateKey(keyAlgorithm)
+	if err != nil {
+		return record, err
+	}
+	now := time.Now()
+	record.CreatedAt = now
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Model(&models.SigningKey{}).Where("retired_at IS NULL").Update("retired_at", now); result.Error != nil {
+			return result.Error
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return record, err
+	}
+	return record, keys.load()
+}
+
+func generateKey(algorithm string) (models.SigningKey, error) {
+
+	var private interface{}
+	var err error
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported signing algorithm %s", algorithm)
+	}
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+	return models.SigningKey{
+		KID:        uuid.New().String(),
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}, nil
+}
+
+func parseKey(record models.SigningKey) (*signingKey, error) {
+
+	block, _ := pem.Decode([]byte(record.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s isn't PEM encoded", record.KID)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key := &signingKey{kid: record.KID, createdAt: record.CreatedAt, retiredAt: record.RetiredAt}
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private = jwt.SigningMethodRS256, private
+	case ed25519.PrivateKey:
+		key.method, key.private = jwt.SigningMethodEdDSA, private
+	default:
+		return nil, fmt.Errorf("signing key %s has an unsupported type", record.KID)
+	}
+	if key.method.Alg() != record.Algorithm {
+		return nil, fmt.Errorf("signing key %s doesn't match its algorithm %s", record.KID, record.Algorithm)
+	}
+	return key, nil
+}
+
+// load reads the keys still inside their overlap window.
+func (s *keySet) load() error {
+
+	var records []models.SigningKey
+	result := initializers.DB.Order("created_at").
+		Find(&records, "retired_at IS NULL OR retired_at > ?", time.Now().Add(-keyOverlap))
+	if result.Error != nil {
+		return result.Error
+	}
+	loaded := make(map[string]*signingKey, len(records))
+	var active *signingKey
+	for _, record := range records {
+		key, err := parseKey(record)
+		if err != nil {
+			return err
+		}
+		loaded[key.kid] = key
+		if key.retiredAt == nil {
+			active = key
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = loaded
+	s.active = active
+	s.loadedAt = time.Now()
+	return nil
+}
+
+func (s *keySet) stale() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return time.Since(s.loadedAt) > keyRefreshInterval
+}
+
+func (s *keySet) signer() (*signingKey, error) {
+
+	if s.stale() {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.active == nil {
+		return nil, errors.New("no active signing key")
+	}
+	return s.active, nil
+}
+
+// reloadForMiss reports whether an unknown kid may make the keys be read again, and claims the reload if so.
+func (s *keySet) reloadForMiss() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.missedAt) < unknownKeyReloadInterval || now.Sub(s.loadedAt) < unknownKeyReloadInterval {
+		return false
+	}
+	s.missedAt = now
+	return true
+}
+
+// verifier returns the key for kid, reloading for a kid that may have been created by another replica at most
+// once per unknownKeyReloadInterval.
+func (s *keySet) verifier(kid string) (*signingKey, error) {
+
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	s.mu.RUnlock()
+	if s.stale() || (!ok && s.reloadForMiss()) {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+		s.mu.RLock()
+		key, ok = s.keys[kid]
+		s.mu.RUnlock()
+	}
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if key.retiredAt != nil && key.retiredAt.Add(keyOverlap).Before(time.Now()) {
+		return nil, ErrInvalidToken
+	}
+	return key, nil
+}
+
+// Sign signs claims with the active key and names the key in the kid header.
+func Sign(claims jwt.MapClaims) (string, error) {
+
+	key, err := keys.signer()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// Verify checks the signature and expiry of a token against the key named by its kid header and returns its claims.
+func Verify(tokenString string) (jwt.MapClaims, error) {
+
+	var keyErr error
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		key, err := keys.verifier(kid)
+		if err != nil {
+			keyErr = err
+			return nil, err
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.private.Public(), nil
+	})
+	if keyErr != nil && !errors.Is(keyErr, ErrInvalidToken) {
+		return nil, keyErr
+	}
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors == jwt.ValidationErrorExpired {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if _, ok := claims["exp"].(float64); !ok {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// JWK is the public half of a signing key as published in the JWKS document.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKS returns the public keys that currently verify tokens, newest first.
+func JWKS() ([]JWK, error) {
+
+	if keys.stale() {
+		if err := keys.load(); err != nil {
+			return nil, err
+		}
+	}
+	keys.mu.RLock()
+	verifying := make([]*signingKey, 0, len(keys.keys))
+	for _, key := range keys.keys {
+		verifying = append(verifying, key)
+	}
+	keys.mu.RUnlock()
+	sort.Slice(verifying, func(i, j int) bool {
+		return verifying[i].createdAt.After(verifying[j].createdAt)
+	})
+
+	jwks := make([]JWK, 0, len(verifying))
+	for _, key := range verifying {
+		jwk := JWK{KeyID: key.kid, Algorithm: key.method.Alg(), Use: "sig"}
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks, nil
+}
+
+// purgeRetiredKeys deletes keys whose overlap window ended before now.
+func purgeRetiredKeys(now time.Time) (int64, error) {
+	result := initializers.DB.Delete(&models.SigningKey{}, "retired_at < ?", now.Add(-keyOverlap))
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,75 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// IssueResetToken creates a single-use password reset token for user, replacing any earlier one.
+func IssueResetToken(user models.User) (string, error) {
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	reset := models.PasswordReset{
+		UserID:     user.Username,
+		CodeHash:   Hash(token),
+		Expiration: time.Now().Add(resetTokenTTL),
+	}
+	result := initializers.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"code_hash":  reset.CodeHash,
+			"expiration": reset.Expiration,
+			"is_used":    false,
+			"updated_at": time.Now(),
+			"deleted_at": nil,
+		}),
+	}).Create(&reset)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	return token, nil
+}
+
+// RedeemResetToken marks a reset token used and returns the user it was issued to.
+func RedeemResetToken(token string) (models.User, error) {
+
+	var user models.User
+	var reset models.PasswordReset
+	if result := initializers.DB.Take(&reset, "code_hash = ?", Hash(token)); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return user, ErrInvalidResetToken
+		}
+		return user, result.Error
+	}
+	if reset.IsUsed || reset.Expiration.Before(time.Now()) {
+		return user, ErrInvalidResetToken
+	}
+	result := initializers.DB.Model(&models.PasswordReset{}).
+		Where("id = ? AND is_used = ?", reset.ID, false).Update("is_used", true)
+	if result.Error != nil {
+		return user, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return user, ErrInvalidResetToken
+	}
+	if result := initializers.DB.Take(&user, "username = ?", reset.UserID); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return user, ErrInvalidResetToken
+		}
+		return user, result.Error
+	}
+	return user, nil
+}
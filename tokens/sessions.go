@@ -0,0 +1,111 @@
+package tokens
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+)
+
+// lastSeenResolution limits how often requests write the last-seen time of their session.
+const lastSeenResolution = time.Minute
+
+// StartSession records a login of user from ip and userAgent and issues its first pair.
+func StartSession(user models.User, ip string, userAgent string) (Pair, error) {
+
+	session, err := CreateSession(user, ip, userAgent, time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		return Pair{}, err
+	}
+	return IssuePair(user, session.ID)
+}
+
+// CreateSession records a session of user that ends at expiresAt unless it's extended by refreshes.
+func CreateSession(user models.User, ip string, userAgent string, expiresAt time.Time) (models.Session, error) {
+
+	session := models.Session{
+		ID:         uuid.New().String(),
+		UserID:     user.Username,
+		IP:         ip,
+		UserAgent:  userAgent,
+		LastSeenAt: time.Now(),
+		ExpiresAt:  expiresAt,
+	}
+	result := initializers.DB.Create(&session)
+	return session, result.Error
+}
+
+// CheckSession fails with ErrRevokedToken when the session of username has ended, and records it as seen otherwise.
+func CheckSession(sessionID string, username string) error {
+
+	var session models.Session
+	if result := initializers.DB.Take(&session, "id = ? AND user_id = ?", sessionID, username); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		return result.Error
+	}
+	now := time.Now()
+	if session.RevokedAt != nil || session.ExpiresAt.Before(now) {
+		return ErrRevokedToken
+	}
+	if session.LastSeenAt.Add(lastSeenResolution).Before(now) {
+		result := initializers.DB.Model(&models.Session{}).Where("id = ?", sessionID).Update("last_seen_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// Sessions returns the sessions of username that haven't ended, most recently seen first.
+func Sessions(username string) ([]models.Session, error) {
+	var sessions []models.Session
+	result := initializers.DB.Order("last_seen_at DESC").
+		Find(&sessions, "user_id = ? AND revoked_at IS NULL AND expires_at > ?", username, time.Now())
+	return sessions, result.Error
+}
+
+// RevokeSession ends the session id of username. It returns false when there is no such active session.
+func RevokeSession(username string, id string) (bool, error) {
+
+	result := initializers.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, username).Update("revoked_at", time.Now())
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	return true, revokeSession(id)
+}
+
+// RevokeSessions ends every session of username except the one with the ID except, which may be empty.
+func RevokeSessions(username string, except string) (int64, error) {
+
+	var ids []string
+	result := initializers.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND id <> ?", username, except).Pluck("id", &ids)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	for _, id := range ids {
+		if err := revokeSession(id); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(ids)), nil
+}
+
+// revokeSession revokes a session together with its refresh tokens.
+func revokeSession(id string) error {
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if result := tx.Model(&models.Session{}).
+			Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", now); result.Error != nil {
+			return result.Error
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", id).Update("revoked_at", now).Error
+	})
+}
@@ -0,0 +1,286 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrRevokedToken = errors.New("token revoked")
+	ErrInactiveUser = errors.New("user inactive")
+)
+
+var (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+	resetTokenTTL   = time.Hour
+)
+
+func Configure(accessTTL time.Duration, refreshTTL time.Duration, resetTTL time.Duration) {
+	accessTokenTTL = accessTTL
+	refreshTokenTTL = refreshTTL
+	resetTokenTTL = resetTTL
+}
+
+func AccessTokenTTL() time.Duration {
+	return accessTokenTTL
+}
+
+func ResetTokenTTL() time.Duration {
+	return resetTokenTTL
+}
+
+// Pair is what a login or a refresh hands out.
+type Pair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func IssueAccessToken(user models.User, sessionID string) (string, error) {
+
+	now := time.Now()
+	return Sign(jwt.MapClaims{
+		"username": user.Username,
+		"sid":      sessionID,
+		"jti":      uuid.New().String(),
+		"ver":      user.TokenVersion,
+		"iat":      now.Unix(),
+		"exp":      now.Add(accessTokenTTL).Unix(),
+	})
+}
+
+// IssuePair issues an access token and a refresh token for an existing session and extends the session
+// to the expiry of the refresh token.
+func IssuePair(user models.User, sessionID string) (Pair, error) {
+
+	accessToken, err := IssueAccessToken(user, sessionID)
+	if err != nil {
+		return Pair{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Pair{}, err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(secret)
+	now := time.Now()
+	record := models.RefreshToken{
+		UserID:    user.Username,
+		TokenHash: Hash(refreshToken),
+		FamilyID:  sessionID,
+		ExpiresAt: now.Add(refreshTokenTTL),
+	}
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Create(&record); result.Error != nil {
+			return result.Error
+		}
+		return tx.Model(&models.Session{}).Where("id = ?", sessionID).
+			Updates(map[string]interface{}{"expires_at": record.ExpiresAt, "last_seen_at": now}).Error
+	})
+	if err != nil {
+		return Pair{}, err
+	}
+	return Pair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Rotate exchanges a refresh token for a new pair. Presenting a token that was already rotated or revoked
+// revokes its whole session, since it means the token leaked.
+func Rotate(refreshToken string) (Pair, error) {
+
+	var record models.RefreshToken
+	if result := initializers.DB.Take(&record, "token_hash = ?", Hash(refreshToken)); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return Pair{}, ErrInvalidToken
+		}
+		return Pair{}, result.Error
+	}
+	if record.RevokedAt != nil {
+		if err := revokeSession(record.FamilyID); err != nil {
+			return Pair{}, err
+		}
+		return Pair{}, ErrRevokedToken
+	}
+	if record.ExpiresAt.Before(time.Now()) {
+		return Pair{}, ErrInvalidToken
+	}
+
+	var user models.User
+	if result := initializers.DB.Take(&user, "username = ?", record.UserID); result.Error != nil {
+		return Pair{}, ErrInvalidToken
+	}
+	if !user.IsActive {
+		return Pair{}, ErrInactiveUser
+	}
+
+	result := initializers.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", record.ID).Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return Pair{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Someone rotated the same token concurrently.
+		if err := revokeSession(record.FamilyID); err != nil {
+			return Pair{}, err
+		}
+		return Pair{}, ErrRevokedToken
+	}
+	return IssuePair(user, record.FamilyID)
+}
+
+// RevokeRefreshToken revokes the session of a refresh token belonging to username.
+func RevokeRefreshToken(refreshToken string, username string) error {
+
+	var record models.RefreshToken
+	if result := initializers.DB.Take(&record, "token_hash = ? AND user_id = ?", Hash(refreshToken), username); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		return result.Error
+	}
+	return revokeSession(record.FamilyID)
+}
+
+// RevokeAccessToken revokes a single access token until it expires.
+func RevokeAccessToken(claims jwt.MapClaims) error {
+
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return ErrInvalidToken
+	}
+	expiresAt := time.Now().Add(accessTokenTTL)
+	if exp, ok := claims["exp"].(float64); ok {
+		expiresAt = time.Unix(int64(exp), 0)
+	}
+	return initializers.DB.Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+// RevokeUser ends every session of the user: access tokens through TokenVersion, refresh tokens and sessions by revoking them.
+func RevokeUser(username string) error {
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Model(&models.User{}).Where("username = ?", username).
+			Update("token_version", gorm.Expr("token_version + 1")); result.Error != nil {
+			return result.Error
+		}
+		now := time.Now()
+		if result := tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", username).Update("revoked_at", now); result.Error != nil {
+			return result.Error
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", username).Update("revoked_at", now).Error
+	})
+}
+
+// Authenticate verifies an access token and checks it against server-side state, returning its claims and user.
+func Authenticate(tokenString string) (jwt.MapClaims, models.User, error) {
+
+	claims, err := Verify(tokenString)
+	if err != nil {
+		return nil, models.User{}, err
+	}
+	user, err := CheckAccessToken(claims)
+	return claims, user, err
+}
+
+// CheckAccessToken checks the claims of a verified access token against server-side state
+// and returns its user.
+func CheckAccessToken(claims jwt.MapClaims) (models.User, error) {
+
+	var user models.User
+	username, ok := claims["username"].(string)
+	if !ok {
+		return user, ErrInvalidToken
+	}
+	// Tokens issued to OAuth clients carry an audience and aren't accepted by the API.
+	if _, ok := claims["aud"]; ok {
+		return user, ErrInvalidToken
+	}
+	if result := initializers.DB.Take(&user, "username = ?", username); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return user, ErrInvalidToken
+		}
+		return user, result.Error
+	}
+	if !user.IsActive {
+		return user, ErrInactiveUser
+	}
+	version, _ := claims["ver"].(float64)
+	if uint(version) != user.TokenVersion {
+		return user, ErrRevokedToken
+	}
+	if jti, ok := claims["jti"].(string); ok {
+		if result := initializers.DB.Take(&models.RevokedToken{}, "jti = ?", jti); result.RowsAffected > 0 {
+			return user, ErrRevokedToken
+		}
+	}
+	sessionID, ok := claims["sid"].(string)
+	if !ok {
+		return user, ErrInvalidToken
+	}
+	if err := CheckSession(sessionID, user.Username); err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// PurgeExpired deletes refresh tokens, revoked access tokens and sessions that have expired anyway, and signing keys
+// past their overlap window.
+func PurgeExpired(now time.Time) (int64, error) {
+
+	refreshTokens := initializers.DB.Unscoped().Delete(&models.RefreshToken{}, "expires_at < ?", now)
+	if refreshTokens.Error != nil {
+		return 0, refreshTokens.Error
+	}
+	revokedTokens := initializers.DB.Delete(&models.RevokedToken{}, "expires_at < ?", now)
+	if revokedTokens.Error != nil {
+		return 0, revokedTokens.Error
+	}
+	sessions := initializers.DB.Delete(&models.Session{}, "expires_at < ?", now)
+	if sessions.Error != nil {
+		return 0, sessions.Error
+	}
+	retiredKeys, err := purgeRetiredKeys(now)
+	if err != nil {
+		return 0, err
+	}
+	return refreshTokens.RowsAffected + revokedTokens.RowsAffected + sessions.RowsAffected + retiredKeys, nil
+}
+
+// Rejected reports whether err means the token must be refused, as opposed to a failure checking it.
+func Rejected(err error) bool {
+	return errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrExpiredToken) || errors.Is(err, ErrExpiredAPIToken) ||
+		errors.Is(err, ErrRevokedToken) || errors.Is(err, ErrInactiveUser)
+}
+
+func Message(err error) string {
+	switch {
+	case errors.Is(err, ErrExpiredToken), errors.Is(err, ErrExpiredAPIToken):
+		return "Token expired"
+	case errors.Is(err, ErrRevokedToken):
+		return "Token revoked"
+	case errors.Is(err, ErrInactiveUser):
+		return "User inactive"
+	}
+	return "Invalid token"
+}
@@ -0,0 +1,298 @@
+package twofactor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/guptaharsh13/balkanid-task/authz"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotEnrolled      = errors.New("two-factor authentication not enrolled")
+	ErrAlreadyEnabled   = errors.New("two-factor authentication already enabled")
+	ErrInvalidCode      = errors.New("invalid code")
+	ErrInvalidChallenge = errors.New("invalid challenge")
+)
+
+const (
+	recoveryCodeCount = 10
+	// maxChallengeAttempts is how many wrong codes a login challenge takes before it's thrown away.
+	maxChallengeAttempts = 5
+)
+
+var (
+	issuer           = "balkanid-task"
+	requireForAdmins = true
+	challengeTTL     = 5 * time.Minute
+)
+
+func Configure(issuerName string, adminsRequired bool, ttl time.Duration) {
+	issuer = issuerName
+	requireForAdmins = adminsRequired
+	challengeTTL = ttl
+}
+
+func ChallengeTTL() time.Duration {
+	return challengeTTL
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// Required reports whether user has to log in with a second factor, because it's an admin
+// or holds a role that requires it.
+func Required(user models.User) (bool, error) {
+
+	if user.IsAdmin && requireForAdmins {
+		return true, nil
+	}
+	resolution, err := authz.Resolve(user.Username)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range resolution.Roles {
+		if role.RequireTwoFactor {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func Enabled(username string) (bool, error) {
+
+	var enrollment models.TwoFactor
+	result := initializers.DB.Limit(1).Find(&enrollment, "user_id = ? AND confirmed_at IS NOT NULL", username)
+	return result.RowsAffected > 0, result.Error
+}
+
+// Enroll starts or restarts an enrollment with a new secret. It isn't used for logins until confirmed.
+func Enroll(username string) (string, string, error) {
+
+	enabled, err := Enabled(username)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", ErrAlreadyEnabled
+	}
+	secret, err := GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	enrollment := models.TwoFactor{UserID: username, Secret: secret}
+	result := initializers.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"secret": secret, "last_used_step": 0, "updated_at": time.Now()}),
+	}).Create(&enrollment)
+	if result.Error != nil {
+		return "", "", result.Error
+	}
+	return secret, ProvisioningURI(issuer, username, secret), nil
+}
+
+// Confirm enables a pending enrollment once the user proves the authenticator works, and returns fresh recovery codes.
+func Confirm(username string, code string) ([]string, error) {
+
+	var enrollment models.TwoFactor
+	if result := initializers.DB.Take(&enrollment, "user_id = ?", username); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotEnrolled
+		}
+		return nil, result.Error
+	}
+	if enrollment.ConfirmedAt != nil {
+		return nil, ErrAlreadyEnabled
+	}
+	step, ok := ValidateCode(enrollment.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	var codes []string
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.TwoFactor{}).Where("user_id = ? AND confirmed_at IS NULL", username).
+			Updates(map[string]interface{}{"confirmed_at": time.Now(), "last_used_step": step})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAlreadyEnabled
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, username)
+		return err
+	})
+	return codes, err
+}
+
+// VerifyCode checks a TOTP code of an enabled enrollment. Every code is accepted at most once.
+func VerifyCode(username string, code string) error {
+
+	var enrollment models.TwoFactor
+	if result := initializers.DB.Take(&enrollment, "user_id = ? AND confirmed_at IS NOT NULL", username); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrNotEnrolled
+		}
+		return result.Error
+	}
+	step, ok := ValidateCode(enrollment.Secret, code, time.Now())
+	if !ok {
+		return ErrInvalidCode
+	}
+	result := initializers.DB.Model(&models.TwoFactor{}).
+		Where("user_id = ? AND last_used_step < ?", username, step).Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// UseRecoveryCode spends one of the recovery codes of username.
+func UseRecoveryCode(username string, code string) error {
+
+	code = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	result := initializers.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", username, hash(code)).Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// Verify accepts either a TOTP code or a recovery code.
+func Verify(username string, code string, recoveryCode string) error {
+	if len(recoveryCode) > 0 {
+		return UseRecoveryCode(username, recoveryCode)
+	}
+	return VerifyCode(username, code)
+}
+
+func RegenerateRecoveryCodes(username string) ([]string, error) {
+
+	var codes []string
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, username)
+		return err
+	})
+	return codes, err
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, username string) ([]string, error) {
+
+	if result := tx.Delete(&models.RecoveryCode{}, "user_id = ?", username); result.Error != nil {
+		return nil, result.Error
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := encoding.EncodeToString(raw)
+		codes = append(codes, code[:8]+"-"+code[8:])
+		records = append(records, models.RecoveryCode{UserID: username, CodeHash: hash(code)})
+	}
+	if result := tx.Create(&records); result.Error != nil {
+		return nil, result.Error
+	}
+	return codes, nil
+}
+
+// Disable removes the enrollment and the recovery codes of username.
+func Disable(username string) error {
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Delete(&models.RecoveryCode{}, "user_id = ?", username); result.Error != nil {
+			return result.Error
+		}
+		return tx.Delete(&models.TwoFactor{}, "user_id = ?", username).Error
+	})
+}
+
+// NewChallenge starts the second step of a login for username.
+func NewChallenge(username string) (string, error) {
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(raw)
+	record := models.LoginChallenge{
+		ChallengeHash: hash(challenge),
+		UserID:        username,
+		ExpiresAt:     time.Now().Add(challengeTTL),
+	}
+	if result := initializers.DB.Create(&record); result.Error != nil {
+		return "", result.Error
+	}
+	return challenge, nil
+}
+
+// TakeChallenge returns the login challenge if it hasn't expired or run out of attempts.
+func TakeChallenge(challenge string) (models.LoginChallenge, error) {
+
+	var record models.LoginChallenge
+	result := initializers.DB.Take(&record, "challenge_hash = ? AND expires_at > ? AND attempts < ?",
+		hash(challenge), time.Now(), maxChallengeAttempts)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return record, ErrInvalidChallenge
+		}
+		return record, result.Error
+	}
+	return record, nil
+}
+
+// AttemptChallenge counts an attempt at a code against the login challenge and returns it, unless it expired
+// or ran out of attempts. Counting and checking in one statement keeps parallel guesses from sharing an attempt.
+func AttemptChallenge(challenge string) (models.LoginChallenge, error) {
+
+	var records []models.LoginChallenge
+	result := initializers.DB.Raw(`UPDATE login_challenges SET attempts = attempts + 1
+		WHERE challenge_hash = ? AND expires_at > ? AND attempts < ? RETURNING *`,
+		hash(challenge), time.Now(), maxChallengeAttempts).Scan(&records)
+	if result.Error != nil {
+		return models.LoginChallenge{}, result.Error
+	}
+	if len(records) == 0 {
+		return models.LoginChallenge{}, ErrInvalidChallenge
+	}
+	return records[0], nil
+}
+
+// CompleteChallenge consumes the challenge. It returns ErrInvalidChallenge when a concurrent request got there first.
+func CompleteChallenge(record models.LoginChallenge) error {
+
+	result := initializers.DB.Delete(&models.LoginChallenge{}, "challenge_hash = ?", record.ChallengeHash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidChallenge
+	}
+	return nil
+}
+
+// PurgeExpiredChallenges deletes login challenges that expired before now.
+func PurgeExpiredChallenges(now time.Time) (int64, error) {
+	result := initializers.DB.Delete(&models.LoginChallenge{}, "expires_at < ?", now)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// Pagination describes a page of a listing, read from the page and per_page query parameters.
+type Pagination struct {
+	Page    int   `json:"page"`
+	PerPage int   `json:"per_page"`
+	Total   int64 `json:"total"`
+}
+
+// ParsePagination reads page and per_page, either of which may be empty. Pages start at 1 and hold
+// 20 entries unless asked otherwise, at most 100.
+func ParsePagination(page string, perPage string) (Pagination, error) {
+
+	pagination := Pagination{Page: 1, PerPage: defaultPerPage}
+	if len(page) > 0 {
+		value, err := strconv.Atoi(page)
+		if err != nil || value < 1 {
+			return pagination, errors.New("page must be a positive number")
+		}
+		pagination.Page = value
+	}
+	if len(perPage) > 0 {
+		value, err := strconv.Atoi(perPage)
+		if err != nil || value < 1 || value > maxPerPage {
+			return pagination, errors.New("per_page must be between 1 and 100")
+		}
+		pagination.PerPage = value
+	}
+	return pagination, nil
+}
+
+func (pagination Pagination) Offset() int {
+	return (pagination.Page - 1) * pagination.PerPage
+}
@@ -21,6 +21,10 @@ func formValidationMessage(tag string) string {
 		return "Invalid email"
 	case "username":
 		return "Username must be between 5 and 25 characters long"
+	case "identifier":
+		return "Must start with a letter and contain only letters, numbers and underscores"
+	case "oneof":
+		return "Value is not one of the allowed options"
 	case "password":
 		return "Password must contain at least 8 characters, one uppercase letter, one number, and one special character"
 	}
@@ -18,6 +18,9 @@ func SetupValidator() error {
 	if err := validate.RegisterValidation("password", passwordValidator); err != nil {
 		return err
 	}
+	if err := validate.RegisterValidation("identifier", identifierValidator); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -32,6 +35,11 @@ func IsValidEmail(email string) bool {
 	return re.MatchString(email)
 }
 
+func IsValidIdentifier(identifier string) bool {
+
+	return regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`).MatchString(identifier)
+}
+
 func usernameValidator(fl validator.FieldLevel) bool {
 
 	username := fl.Field().String()
@@ -63,3 +71,8 @@ func passwordValidator(fl validator.FieldLevel) bool {
 	hasSpecial := regexp.MustCompile(`[^a-zA-Z0-9]`).MatchString(password)
 	return hasSpecial
 }
+
+func identifierValidator(fl validator.FieldLevel) bool {
+
+	return IsValidIdentifier(fl.Field().String())
+}
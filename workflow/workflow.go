@@ -0,0 +1,172 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/guptaharsh13/balkanid-task/authz"
+	"github.com/guptaharsh13/balkanid-task/initializers"
+	"github.com/guptaharsh13/balkanid-task/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoInitialState = errors.New("workflow has no initial state")
+	ErrUnknownState   = errors.New("unknown state")
+	ErrStaleStatus    = errors.New("task status changed meanwhile")
+)
+
+// IllegalTransitionError is returned for transitions the workflow doesn't have. Allowed lists the states
+// the task can move to instead.
+type IllegalTransitionError struct {
+	From    string
+	To      string
+	Allowed []string
+}
+
+func (err *IllegalTransitionError) Error() string {
+	if len(err.Allowed) == 0 {
+		return fmt.Sprintf("Can't move task from %s to %s, no transitions leave %s", err.From, err.To, err.From)
+	}
+	return fmt.Sprintf("Can't move task from %s to %s, allowed: %s", err.From, err.To, strings.Join(err.Allowed, ", "))
+}
+
+// ForbiddenTransitionError is returned when the transition is gated by a permission the user isn't granted.
+type ForbiddenTransitionError struct {
+	Reason string
+}
+
+func (err *ForbiddenTransitionError) Error() string {
+	return err.Reason
+}
+
+// InitialState returns the state new tasks start in.
+func InitialState() (models.TaskState, error) {
+
+	var state models.TaskState
+	result := initializers.DB.Limit(1).Find(&state, "is_initial = ?", true)
+	if result.Error != nil {
+		return state, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return state, ErrNoInitialState
+	}
+	return state, nil
+}
+
+// Transitions returns the transitions leaving state.
+func Transitions(state string) ([]models.TaskTransition, error) {
+
+	var transitions []models.TaskTransition
+	if result := initializers.DB.Order("id").Find(&transitions, "from_state = ?", state); result.Error != nil {
+		return nil, result.Error
+	}
+	return transitions, nil
+}
+
+// permitted checks the permission gating transition against task. A gate naming a permission
+// that no longer exists only lets admins through.
+func permitted(transition models.TaskTransition, username string, task models.Task) (authz.Decision, error) {
+
+	if len(transition.Permission) == 0 {
+		return authz.Decision{Allowed: true}, nil
+	}
+	var permission models.Permission
+	result := initializers.DB.Limit(1).Find(&permission, "name = ?", transition.Permission)
+	if result.Error != nil {
+		return authz.Decision{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		resolution, err := authz.Resolve(username)
+		if err != nil {
+			return authz.Decision{}, err
+		}
+		if resolution.User.IsAdmin {
+			return authz.Decision{Allowed: true}, nil
+		}
+		return authz.Decision{Allowed: false, Reason: fmt.Sprintf("Permission %s gating the transition doesn't exist", transition.Permission)}, nil
+	}
+	return authz.Decide(username, permission.Table, permission.Operation, authz.TaskAttributes(task))
+}
+
+// Available returns the states username may move task to.
+func Available(task models.Task, username string) ([]string, error) {
+
+	transitions, err := Transitions(task.Status)
+	if err != nil {
+		return nil, err
+	}
+	available := []string{}
+	for _, transition := range transitions {
+		decision, err := permitted(transition, username, task)
+		if err != nil {
+			return nil, err
+		}
+		if decision.Allowed {
+			available = append(available, transition.To)
+		}
+	}
+	return available, nil
+}
+
+// Transition moves task to the state to on behalf of username and records the change in its history and feed.
+func Transition(task models.Task, to string, username string, comment string) (models.TaskStatusChange, error) {
+
+	var change models.TaskStatusChange
+	if result := initializers.DB.Take(&models.TaskState{}, "name = ?", to); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return change, ErrUnknownState
+		}
+		return change, result.Error
+	}
+	transitions, err := Transitions(task.Status)
+	if err != nil {
+		return change, err
+	}
+	var transition *models.TaskTransition
+	allowed := []string{}
+	for i := range transitions {
+		allowed = append(allowed, transitions[i].To)
+		if transitions[i].To == to {
+			transition = &transitions[i]
+		}
+	}
+	if transition == nil {
+		return change, &IllegalTransitionError{From: task.Status, To: to, Allowed: allowed}
+	}
+	decision, err := permitted(*transition, username, task)
+	if err != nil {
+		return change, err
+	}
+	if !decision.Allowed {
+		return change, &ForbiddenTransitionError{Reason: decision.Reason}
+	}
+
+	change = models.TaskStatusChange{TaskID: task.ID, From: task.Status, To: to, ChangedBy: username, Comment: comment}
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		// Only moves the task if nobody else moved it since it was read.
+		result := tx.Model(&models.Task{}).Where("id = ? AND status = ?", task.ID, task.Status).Update("status", to)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrStaleStatus
+		}
+		if err := tx.Create(&change).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TaskActivity{TaskID: task.ID, Actor: username, Kind: models.ActivityStatusChanged, StatusChangeID: &change.ID}).Error
+	})
+	return change, err
+}
+
+// History returns the transitions made on the task, oldest first.
+func History(taskID uint) ([]models.TaskStatusChange, error) {
+
+	var changes []models.TaskStatusChange
+	if result := initializers.DB.Order("created_at").Order("id").Find(&changes, "task_id = ?", taskID); result.Error != nil {
+		return nil, result.Error
+	}
+	return changes, nil
+}